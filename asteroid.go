@@ -1,5 +1,7 @@
 package avi
 
+import "github.com/go-gl/mathgl/mgl64"
+
 const asteroidTexture = "asteroid"
 
 type asteroid struct {
@@ -12,6 +14,8 @@ type AsteroidConf struct {
 	Radius   float64   `yaml:"radius" json:"radius"`
 	Position []float64 `yaml:"position" json:"position"`
 	Texture  string    `yaml:"texture" json:"texture"`
+	// Initial velocity, asteroids are stationary by default.
+	Velocity []float64 `yaml:"velocity" json:"velocity"`
 }
 
 func NewAsteroid(id ID, conf AsteroidConf) (*asteroid, error) {
@@ -19,6 +23,13 @@ func NewAsteroid(id ID, conf AsteroidConf) (*asteroid, error) {
 	if err != nil {
 		return nil, err
 	}
+	var vel mgl64.Vec3
+	if len(conf.Velocity) > 0 {
+		vel, err = sliceToVec(conf.Velocity)
+		if err != nil {
+			return nil, err
+		}
+	}
 	texture := conf.Texture
 	if texture == "" {
 		texture = asteroidTexture
@@ -27,6 +38,7 @@ func NewAsteroid(id ID, conf AsteroidConf) (*asteroid, error) {
 		objectT: objectT{
 			id:       id,
 			position: pos,
+			velocity: vel,
 			mass:     conf.Mass,
 			radius:   conf.Radius,
 		},
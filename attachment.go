@@ -0,0 +1,104 @@
+package avi
+
+import "github.com/go-gl/mathgl/mgl64"
+
+// Objects that can be attached to another object.
+type attachable interface {
+	Object
+	setAttachment(parent ID, offset mgl64.Vec3, attached bool)
+}
+
+// Embeddable attachment state, implements the Attached drawable interface.
+type attachmentT struct {
+	parent   ID
+	offset   mgl64.Vec3
+	attached bool
+}
+
+func (a *attachmentT) Parent() (ID, bool) {
+	return a.parent, a.attached
+}
+
+func (a *attachmentT) Offset() mgl64.Vec3 {
+	return a.offset
+}
+
+func (a *attachmentT) setAttachment(parent ID, offset mgl64.Vec3, attached bool) {
+	a.parent = parent
+	a.offset = offset
+	a.attached = attached
+}
+
+// An object carried by a parent object at a fixed offset.
+type attachment struct {
+	obj    attachable
+	parent Object
+	offset mgl64.Vec3
+}
+
+// Attach obj to parent, the object moves with the parent and a ship parent carries its mass.
+func (sim *Simulation) attach(obj attachable, parent Object, offset mgl64.Vec3) {
+	sim.detach(obj)
+	sim.attachments[obj.ID()] = &attachment{
+		obj:    obj,
+		parent: parent,
+		offset: offset,
+	}
+	if ship, ok := parent.(*shipT); ok {
+		ship.mass += obj.Mass()
+	}
+	obj.setAttachment(parent.ID(), offset, true)
+	obj.setPosition(parent.Position().Add(offset))
+	obj.setVelocity(parent.Velocity())
+}
+
+// Detach obj from its parent, leaving it at rest where it is.
+func (sim *Simulation) detach(obj attachable) {
+	a, ok := sim.attachments[obj.ID()]
+	if !ok {
+		return
+	}
+	delete(sim.attachments, obj.ID())
+	if ship, ok := a.parent.(*shipT); ok {
+		ship.mass -= obj.Mass()
+	}
+	obj.setAttachment(NilID, mgl64.Vec3{}, false)
+	obj.setVelocity(mgl64.Vec3{})
+}
+
+// Detach all objects attached to parent.
+func (sim *Simulation) detachAll(parent Object) {
+	for _, a := range sim.attachments {
+		if a.parent == parent {
+			sim.detach(a.obj)
+		}
+	}
+}
+
+// Returns the parent obj is attached to.
+func (sim *Simulation) attachedTo(obj Object) (Object, bool) {
+	a, ok := sim.attachments[obj.ID()]
+	if !ok {
+		return nil, false
+	}
+	return a.parent, true
+}
+
+// Returns the IDs of all objects attached to parent.
+func (sim *Simulation) attachedIDs(parent Object) []ID {
+	var ids []ID
+	for id, a := range sim.attachments {
+		if a.parent == parent {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Move attached objects along with their parents.
+func (sim *Simulation) moveAttachments() {
+	for _, a := range sim.attachments {
+		a.obj.setPosition(a.parent.Position().Add(a.offset))
+		a.obj.setVelocity(a.parent.Velocity())
+	}
+}
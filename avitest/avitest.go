@@ -0,0 +1,291 @@
+// Package avitest runs small scenarios for testing pilots.
+//
+// A scenario is built from inline YAML in the same format as the files in the
+// data directory, stepped tick by tick and inspected between steps:
+//
+//	s := avitest.New(t, `
+//	control_points:
+//	  - {position: [0, 0, 0], radius: 10, mass: 1e6, points: 1, influence: 100}
+//	`, fleetYAML)
+//	me := s.Fleet("mine")[0]
+//	s.AssertWithin(20*time.Second, avitest.Reached(me.ID, mgl64.Vec3{}, 100), "reach control point")
+//
+// Maps default to a large radius, one starting point at the origin per fleet
+// and no fleet mass limit. The game mode never stops a scenario,
+// it runs until its conditions are met or its time runs out.
+package avitest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"gopkg.in/yaml.v2"
+)
+
+// Parts available to scenario ships unless other parts are given.
+const DefaultParts = `
+engines:
+  nuclear:
+    mass: 10000
+    radius: 10
+    energy: 10000
+thrusters:
+  rocket:
+    mass: 1000
+    radius: 5
+    energy: 75
+    force: 1.5e4
+weapons:
+  rifle:
+    mass: 400
+    radius: 2
+    energy: 1
+    ammo_mass: 1
+    ammo_radius: 0.05
+    ammo_velocity: 1000
+    ammo_capacity: 1e3
+    cooldown: 1
+sensors:
+  antenna:
+    mass: 150
+    radius: 0.5
+    energy: 2
+    power: 10
+comms:
+  radio:
+    mass: 1
+    radius: 0.05
+    energy: 1
+    range: 10000
+`
+
+const defaultRadius = 100000
+
+// Scenarios never end because of the game's max time.
+const maxTime = 24 * time.Hour
+
+// Sim is a simulation under test.
+type Sim struct {
+	*avi.Simulation
+	t testing.TB
+}
+
+// Create a scenario from a map and fleets in YAML using the default parts.
+func New(t testing.TB, mapYAML string, fleetYAMLs ...string) *Sim {
+	return NewWithParts(t, DefaultParts, mapYAML, fleetYAMLs...)
+}
+
+// Create a scenario from a part set, a map and fleets in YAML.
+func NewWithParts(t testing.TB, partsYAML, mapYAML string, fleetYAMLs ...string) *Sim {
+	t.Helper()
+	sim, err := build(partsYAML, mapYAML, fleetYAMLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	return &Sim{
+		Simulation: sim,
+		t:          t,
+	}
+}
+
+func build(partsYAML, mapYAML string, fleetYAMLs []string) (*avi.Simulation, error) {
+	var parts avi.PartSetConf
+	if err := yaml.Unmarshal([]byte(partsYAML), &parts); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid parts: %s", err.Error()))
+	}
+	var mp avi.MapConf
+	if err := yaml.Unmarshal([]byte(mapYAML), &mp); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid map: %s", err.Error()))
+	}
+	fleets := make([]avi.FleetConf, len(fleetYAMLs))
+	for i, f := range fleetYAMLs {
+		if err := yaml.Unmarshal([]byte(f), &fleets[i]); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid fleet %d: %s", i, err.Error()))
+		}
+	}
+
+	if mp.Radius == 0 {
+		mp.Radius = defaultRadius
+	}
+	for len(mp.StartingPoints) < len(fleets) {
+		mp.StartingPoints = append(mp.StartingPoints, []float64{0, 0, 0})
+	}
+	if mp.Rules.MaxFleetMass == 0 {
+		mp.Rules.MaxFleetMass = math.MaxFloat64
+	}
+	return avi.NewSimulation(mp, parts, fleets, nil, maxTime, 60)
+}
+
+// Step the simulation n ticks.
+func (s *Sim) Step(n int) {
+	for i := 0; i < n; i++ {
+		s.Simulation.Step()
+	}
+}
+
+// Step the simulation for d of simulated time.
+func (s *Sim) Run(d time.Duration) {
+	s.Step(ticks(d))
+}
+
+func ticks(d time.Duration) int {
+	return int(d.Seconds() / avi.SecondsPerTick)
+}
+
+// Seconds of simulated time so far.
+func (s *Sim) Time() float64 {
+	return float64(s.CurrentTick()) * avi.SecondsPerTick
+}
+
+// State of the ship, false if the ship does not exist or has been destroyed.
+func (s *Sim) Ship(id avi.ID) (avi.ShipState, bool) {
+	for _, ship := range s.Ships() {
+		if ship.ID == id {
+			return ship, true
+		}
+	}
+	return avi.ShipState{}, false
+}
+
+// State of the ships alive in a fleet, in the order of the fleet's conf.
+func (s *Sim) Fleet(name string) []avi.ShipState {
+	var ships []avi.ShipState
+	for _, ship := range s.Ships() {
+		if ship.Fleet == name {
+			ships = append(ships, ship)
+		}
+	}
+	return ships
+}
+
+// Script flies a scripted ship, it is called every tick with the ship's pilot.
+type Script func(tick int64, p *avi.GenericPilot)
+
+type scriptPilot struct {
+	avi.GenericPilot
+	script Script
+}
+
+func (p *scriptPilot) Tick(tick int64) {
+	if p.script != nil {
+		p.script(tick, &p.GenericPilot)
+	}
+}
+
+// Add a ship flown by a script to its own fleet, its position is absolute.
+// Scripted fleets are their own team. A nil script leaves the ship adrift.
+func (s *Sim) AddScripted(fleet string, shipYAML string, script Script) avi.ID {
+	s.t.Helper()
+	var conf avi.ShipConf
+	if err := yaml.Unmarshal([]byte(shipYAML), &conf); err != nil {
+		s.t.Fatalf("invalid ship: %s", err)
+	}
+	pos := mgl64.Vec3{}
+	if len(conf.Position) != 0 {
+		if len(conf.Position) != 3 {
+			s.t.Fatalf("invalid ship position %v", conf.Position)
+		}
+		pos = mgl64.Vec3{conf.Position[0], conf.Position[1], conf.Position[2]}
+	}
+	p := &scriptPilot{script: script}
+	p.JoinFleet(fleet)
+	p.JoinTeam(fleet)
+	ship, err := s.AddShip(fleet, pos, p, conf)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return ship.ID()
+}
+
+// Script that fires the engines and thrusts with a constant acceleration.
+func Thrust(acc mgl64.Vec3) Script {
+	return func(tick int64, p *avi.GenericPilot) {
+		for _, e := range p.Engines {
+			e.PowerOn(1)
+		}
+		if avi.LengthSq(acc) == 0 || len(p.Thrusters) == 0 {
+			return
+		}
+		share := acc.Mul(1 / float64(len(p.Thrusters)))
+		for _, t := range p.Thrusters {
+			t.Thrust(share)
+		}
+	}
+}
+
+// A Condition reports whether the scenario has reached some state.
+type Condition func(s *Sim) bool
+
+// Step until the condition is met or d of simulated time has passed,
+// reports whether the condition was met.
+func (s *Sim) RunUntil(d time.Duration, c Condition) bool {
+	for i := ticks(d); i > 0; i-- {
+		if c(s) {
+			return true
+		}
+		s.Simulation.Step()
+	}
+	return c(s)
+}
+
+// Fail the test unless the condition is met within d of simulated time.
+func (s *Sim) AssertWithin(d time.Duration, c Condition, msg string) bool {
+	s.t.Helper()
+	if !s.RunUntil(d, c) {
+		s.t.Errorf("%s: not met within %v", msg, d)
+		return false
+	}
+	return true
+}
+
+// Fail the test if the condition is met within d of simulated time.
+func (s *Sim) AssertNever(d time.Duration, c Condition, msg string) bool {
+	s.t.Helper()
+	if s.RunUntil(d, c) {
+		s.t.Errorf("%s: met after %fs", msg, s.Time())
+		return false
+	}
+	return true
+}
+
+// The ship is within dist of pos.
+func Reached(id avi.ID, pos mgl64.Vec3, dist float64) Condition {
+	return func(s *Sim) bool {
+		ship, ok := s.Ship(id)
+		return ok && avi.LengthSq(ship.Position.Sub(pos)) <= dist*dist
+	}
+}
+
+// The ship's projectiles have hit ships of other teams at least n times.
+func Hit(id avi.ID, n int) Condition {
+	return func(s *Sim) bool {
+		ship, ok := s.Ship(id)
+		return ok && ship.Hits >= n
+	}
+}
+
+// The ship has been destroyed.
+func Destroyed(id avi.ID) Condition {
+	return func(s *Sim) bool {
+		_, ok := s.Ship(id)
+		return !ok
+	}
+}
+
+// All of the conditions are met.
+func All(cs ...Condition) Condition {
+	return func(s *Sim) bool {
+		for _, c := range cs {
+			if !c(s) {
+				return false
+			}
+		}
+		return true
+	}
+}
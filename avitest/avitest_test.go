@@ -0,0 +1,93 @@
+package avitest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/avitest"
+)
+
+const duds = `
+name: duds
+ships:
+  - pilot: dud
+    position: [0, 0, 0]
+    hull_strength: 1
+    parts:
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+  - pilot: dud
+    position: [0, 100, 0]
+    hull_strength: 1
+    parts:
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+`
+
+const gunship = `
+position: [-200, 0, 0]
+hull_strength: 1
+parts:
+  - {name: nuclear, type: engine, position: [0, 0, 0]}
+  - {name: rifle, type: weapon, position: [15, 0, 0]}
+`
+
+const rocket = `
+position: [0, -50, 0]
+hull_strength: 1
+parts:
+  - {name: nuclear, type: engine, position: [0, 0, 0]}
+  - {name: rocket, type: thruster, position: [0, 20, 0]}
+`
+
+func TestFleets(t *testing.T) {
+	s := avitest.New(t, `starting_points: [[0, 0, 50]]`, duds)
+	ships := s.Fleet("duds")
+	if len(ships) != 2 {
+		t.Fatalf("unexpected ships %v", ships)
+	}
+	if ships[1].Position != (mgl64.Vec3{0, 100, 50}) || ships[1].Team != "duds" {
+		t.Errorf("unexpected ship %v", ships[1])
+	}
+	if _, ok := ships[0].Pilot.(*avi.DudPilot); !ok {
+		t.Errorf("unexpected pilot %T", ships[0].Pilot)
+	}
+	s.Run(time.Second)
+	if s.CurrentTick() != 1000 || s.Time() != 1 {
+		t.Errorf("unexpected tick %d", s.CurrentTick())
+	}
+}
+
+func TestScripted(t *testing.T) {
+	s := avitest.New(t, ``, duds)
+	id := s.AddScripted("rockets", rocket, avitest.Thrust(mgl64.Vec3{0, -1, 0}))
+	if ship, ok := s.Ship(id); !ok || ship.Team != "rockets" {
+		t.Fatalf("unexpected ship %v", ship)
+	}
+	// Accelerating at 1m/s^2 covers 2m in 2s
+	s.AssertWithin(3*time.Second, avitest.Reached(id, mgl64.Vec3{0, -52, 0}, 0.5), "reached")
+	s.AssertNever(time.Second, avitest.Reached(id, mgl64.Vec3{0, -50, 0}, 1), "turned back")
+}
+
+func TestHit(t *testing.T) {
+	s := avitest.New(t, ``, duds)
+	fired := false
+	shooter := s.AddScripted("gunners", gunship, func(tick int64, p *avi.GenericPilot) {
+		p.Engines[0].PowerOn(1)
+		if !fired && tick > p.Weapons[0].GetCoolDownTicks() {
+			fired = p.Weapons[0].Fire(mgl64.Vec3{1, 0, 0}) == nil
+		}
+	})
+	target := s.Fleet("duds")[0].ID
+	// Weapons are cooling down for their first second
+	if !s.AssertWithin(2*time.Second, avitest.Hit(shooter, 1), "hit target") {
+		return
+	}
+	if !fired {
+		t.Error("expected the shooter to have fired")
+	}
+	if ship, ok := s.Ship(target); ok && ship.Hits != 0 {
+		t.Errorf("unexpected hits by the target %d", ship.Hits)
+	}
+	s.AssertWithin(time.Second, avitest.Destroyed(target), "target destroyed")
+}
@@ -0,0 +1,212 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// Ships that leave the map are destroyed.
+	BoundaryDestroy = "destroy"
+	// Ships are allowed to leave the map.
+	BoundaryIgnore = "ignore"
+	// The edge of the map is a solid wall that ships bounce off of.
+	BoundaryWall = "wall"
+	// Ships leaving the map reappear on the opposite side, projectiles are destroyed.
+	BoundaryWrap = "wrap"
+	// The map shrinks over time, damaging ships caught outside.
+	BoundaryShrink = "shrink"
+)
+
+const defaultBoundaryDamage = 100
+
+// Conf format for the behavior of the edge of the map.
+// Any value left unset is replaced with its default.
+type BoundaryConf struct {
+	// One of 'destroy', 'ignore', 'wall', 'wrap' or 'shrink'.
+	Mode string `yaml:"mode" json:"mode"`
+	// Coefficient of restitution of the wall, defaults to the physics object_cor.
+	COR *float64 `yaml:"cor" json:"cor"`
+	// Time in seconds before the boundary starts to shrink.
+	ShrinkStart float64 `yaml:"shrink_start" json:"shrink_start"`
+	// Rate in meters per second that the boundary shrinks.
+	ShrinkRate float64 `yaml:"shrink_rate" json:"shrink_rate"`
+	// The boundary never shrinks smaller than this radius.
+	MinRadius float64 `yaml:"min_radius" json:"min_radius"`
+	// Damage per second dealt to ships outside the shrinking boundary, defaults to 100.
+	Damage *float64 `yaml:"damage" json:"damage"`
+}
+
+func (c BoundaryConf) withDefaults() BoundaryConf {
+	if c.Mode == "" {
+		c.Mode = BoundaryDestroy
+	}
+	return c
+}
+
+func (c BoundaryConf) Validate() error {
+	switch c.Mode {
+	case "", BoundaryDestroy, BoundaryIgnore, BoundaryWall, BoundaryWrap, BoundaryShrink:
+	default:
+		return errors.New(fmt.Sprintf("unknown boundary mode '%s'", c.Mode))
+	}
+	if c.COR != nil && (*c.COR < 0 || *c.COR > 1) {
+		return errors.New(fmt.Sprintf("boundary cor must be between 0 and 1: %f", *c.COR))
+	}
+	if c.ShrinkStart < 0 || c.ShrinkRate < 0 || c.MinRadius < 0 || c.Damage != nil && *c.Damage < 0 {
+		return errors.New("boundary shrink_start, shrink_rate, min_radius and damage must not be negative")
+	}
+	return nil
+}
+
+// Returns the boundary conf with the deprecated physics out_of_bounds rule applied.
+func (r RulesConf) boundaryConf() (BoundaryConf, error) {
+	c := r.Boundary
+	oob := r.Physics.OutOfBounds
+	if oob == "" {
+		return c, nil
+	}
+	if c.Mode != "" && c.Mode != oob {
+		return c, errors.New(fmt.Sprintf("out_of_bounds rule '%s' conflicts with boundary mode '%s'", oob, c.Mode))
+	}
+	c.Mode = oob
+	return c, nil
+}
+
+// Scan result of the map boundary.
+type BoundarySR struct {
+	Mode string
+	// Current radius of the boundary centered on the origin.
+	Radius float64
+	// Radius the boundary will shrink to.
+	MinRadius float64
+	// Rate the boundary is currently shrinking.
+	ShrinkRate float64
+}
+
+type boundary struct {
+	conf   BoundaryConf
+	cor    float64
+	damage float64
+	radius float64
+	// Largest radius of the boundary.
+	mapRadius float64
+}
+
+func newBoundary(conf BoundaryConf, p physicsT, radius float64) *boundary {
+	b := &boundary{
+		conf:      conf.withDefaults(),
+		cor:       valueOr(conf.COR, p.objectCOR),
+		damage:    valueOr(conf.Damage, defaultBoundaryDamage),
+		radius:    radius,
+		mapRadius: radius,
+	}
+	if b.conf.MinRadius > radius {
+		b.conf.MinRadius = radius
+	}
+	return b
+}
+
+// Update the radius of the boundary for the given tick.
+func (b *boundary) update(tick int64) {
+	if b.conf.Mode != BoundaryShrink {
+		return
+	}
+	elapsed := float64(tick)*SecondsPerTick - b.conf.ShrinkStart
+	if elapsed <= 0 {
+		return
+	}
+	b.radius = math.Max(b.conf.MinRadius, b.mapRadius-b.conf.ShrinkRate*elapsed)
+}
+
+func (b *boundary) shrinking() bool {
+	return b.conf.Mode == BoundaryShrink && b.radius > b.conf.MinRadius
+}
+
+func (b *boundary) scan(tick int64) BoundarySR {
+	sr := BoundarySR{
+		Mode:      b.conf.Mode,
+		Radius:    b.radius,
+		MinRadius: b.radius,
+	}
+	if b.conf.Mode == BoundaryShrink {
+		sr.MinRadius = b.conf.MinRadius
+		if b.shrinking() && float64(tick)*SecondsPerTick >= b.conf.ShrinkStart {
+			sr.ShrinkRate = b.conf.ShrinkRate
+		}
+	}
+	return sr
+}
+
+// Apply the boundary rules to all ships.
+func (sim *Simulation) boundShips() {
+	b := sim.boundary
+	b.update(sim.tick)
+	for _, ship := range sim.ships {
+		switch b.conf.Mode {
+		case BoundaryWall:
+			sim.bounceOffWall(ship)
+		case BoundaryWrap:
+			wrap(ship, b.radius)
+		case BoundaryShrink:
+			if ship.Position().Len() > b.radius {
+				ship.setHealth(ship.Health() - b.damage*SecondsPerTick)
+			}
+		}
+	}
+}
+
+// Apply the boundary rules to a projectile,
+// reporting whether the projectile should be kept.
+func (sim *Simulation) boundProjectile(p *projectile) bool {
+	b := sim.boundary
+	switch b.conf.Mode {
+	case BoundaryWrap, BoundaryWall:
+		return p.Position().Len()+p.Radius() < b.radius
+	default:
+		return p.Position().Len() < b.mapRadius
+	}
+}
+
+// Reports whether a ship should be destroyed for leaving the map.
+func (sim *Simulation) outOfBounds(ship *shipT) bool {
+	if sim.boundary.conf.Mode != BoundaryDestroy {
+		return false
+	}
+	return ship.Position().Len() > sim.boundary.radius
+}
+
+// Reflect a ship that has hit the wall, treating the wall as an immovable object.
+func (sim *Simulation) bounceOffWall(ship *shipT) {
+	r := sim.boundary.radius - ship.Radius()
+	pos := ship.Position()
+	distance := pos.Len()
+	if distance <= r || distance < small {
+		return
+	}
+	norm := pos.Mul(1 / distance)
+	ship.setPosition(norm.Mul(r))
+
+	v := ship.Velocity()
+	vn := v.Dot(norm)
+	// Moving back into the map
+	if vn <= 0 {
+		return
+	}
+	cor := sim.boundary.cor
+	actual := (1.0 + cor) * vn * ship.Mass()
+	elastic := 2.0 * vn * ship.Mass()
+	ship.setHealth(ship.Health() - sim.physics.impulseToDamage*(elastic-actual))
+	ship.setVelocity(v.Sub(norm.Mul((1.0 + cor) * vn)))
+}
+
+// Move an object that has left the radius to the opposite side of the map.
+func wrap(obj Object, radius float64) {
+	pos := obj.Position()
+	distance := pos.Len()
+	if distance <= radius {
+		return
+	}
+	obj.setPosition(pos.Mul(-(radius - small) / distance))
+}
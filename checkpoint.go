@@ -0,0 +1,82 @@
+package avi
+
+import (
+	"errors"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+const checkpointTexture = "checkpoint"
+
+// Conf format for a race checkpoint, checkpoints are passed in the order they are defined.
+type CheckpointConf struct {
+	Position []float64 `yaml:"position" json:"position"`
+	Radius   float64   `yaml:"radius" json:"radius"`
+	Texture  string    `yaml:"texture" json:"texture"`
+}
+
+type checkpoint struct {
+	id       ID
+	index    int
+	position mgl64.Vec3
+	radius   float64
+	texture  string
+}
+
+// Scan result of a checkpoint
+type CheckpointSR struct {
+	ID       ID
+	Index    int
+	Position mgl64.Vec3
+	Radius   float64
+}
+
+func NewCheckpoint(id ID, index int, conf CheckpointConf) (*checkpoint, error) {
+	pos, err := sliceToVec(conf.Position)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Radius <= 0 {
+		return nil, errors.New("checkpoint must have a positive radius")
+	}
+	texture := conf.Texture
+	if texture == "" {
+		texture = checkpointTexture
+	}
+	return &checkpoint{
+		id:       id,
+		index:    index,
+		position: pos,
+		radius:   conf.Radius,
+		texture:  texture,
+	}, nil
+}
+
+func (c *checkpoint) ID() ID {
+	return c.id
+}
+
+func (c *checkpoint) Position() mgl64.Vec3 {
+	return c.position
+}
+
+func (c *checkpoint) Radius() float64 {
+	return c.radius
+}
+
+func (c *checkpoint) Texture() string {
+	return c.texture
+}
+
+func (c *checkpoint) contains(pos mgl64.Vec3) bool {
+	return LengthSq(pos.Sub(c.position)) < c.radius*c.radius
+}
+
+func (c *checkpoint) scan() CheckpointSR {
+	return CheckpointSR{
+		ID:       c.id,
+		Index:    c.index,
+		Position: c.position,
+		Radius:   c.radius,
+	}
+}
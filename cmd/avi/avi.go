@@ -9,6 +9,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi/server"
 	_ "github.com/nathanielc/avi/ships"
+	"github.com/nathanielc/avi/wasm"
 )
 
 var cpuProfile = flag.String("cpuprofile", "", "if defined save a cpu profile to path.")
@@ -39,6 +40,8 @@ func main() {
 		defer pprof.Lookup("heap").WriteTo(f, 0)
 	}
 
+	wasm.SetDataDir(*dataDir)
+
 	server, err := server.New(server.ServerConf{
 		Addr:    *bindAddr,
 		DataDir: *dataDir,
@@ -0,0 +1,111 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Largest message a comms part may send when its conf does not set a limit.
+const defaultMaxMessageSize = 256
+
+// Most messages kept for a ship that has not scanned them, older messages are dropped.
+const maxInboxSize = 64
+
+// Comms broadcasts messages to fleet mates within range that also carry comms.
+// Messages are delivered at the end of the tick and received with the next successful scan.
+type Comms struct {
+	partT
+	energy  float64
+	rng     float64
+	maxSize int
+	outbox  []byte
+}
+
+// Conf format for loading comms from a file
+type CommsConf struct {
+	Mass   float64 `yaml:"mass" json:"mass"`
+	Radius float64 `yaml:"radius" json:"radius"`
+	Energy float64 `yaml:"energy" json:"energy"`
+	Range  float64 `yaml:"range" json:"range"`
+	// Maximum message size in bytes, default 256.
+	MaxSize int `yaml:"max_size" json:"max_size"`
+}
+
+// A Message received from a fleet mate.
+type Message struct {
+	From ID
+	Data []byte
+}
+
+func NewCommsFromConf(pos mgl64.Vec3, conf CommsConf) *Comms {
+	maxSize := conf.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultMaxMessageSize
+	}
+	return &Comms{
+		partT: partT{
+			objectT: objectT{
+				position: pos,
+				mass:     conf.Mass,
+				radius:   conf.Radius,
+			},
+		},
+		energy:  conf.Energy,
+		rng:     conf.Range,
+		maxSize: maxSize,
+	}
+}
+
+func (self *Comms) GetRange() float64 {
+	return self.rng
+}
+
+func (self *Comms) GetMaxSize() int {
+	return self.maxSize
+}
+
+// Broadcast data to fleet mates in range, once per tick.
+func (self *Comms) Broadcast(data []byte) error {
+	if self.used {
+		return errors.New("Already used comms this tick")
+	}
+	if len(data) > self.maxSize {
+		return errors.New(fmt.Sprintf("message of %d bytes exceeds max size %d", len(data), self.maxSize))
+	}
+	self.used = true
+
+	err := self.ship.ConsumeEnergy(self.energy)
+	if err != nil {
+		return err
+	}
+	// Copy so the pilot may reuse its buffer
+	self.outbox = append([]byte{}, data...)
+	return nil
+}
+
+// Deliver the messages broadcast this tick, keeping any messages that were not scanned yet.
+func (sim *Simulation) deliverMessages() {
+	for _, sender := range sim.ships {
+		for _, c := range sender.comms {
+			if c.outbox == nil {
+				continue
+			}
+			msg := Message{From: sender.ID(), Data: c.outbox}
+			c.outbox = nil
+			for _, ship := range sim.ships {
+				if ship == sender || ship.fleet != sender.fleet || len(ship.comms) == 0 {
+					continue
+				}
+				if LengthSq(ship.position.Sub(sender.position)) > c.rng*c.rng {
+					continue
+				}
+				ship.inbox = append(ship.inbox, msg)
+				if n := len(ship.inbox); n > maxInboxSize {
+					ship.inbox = append(ship.inbox[:0], ship.inbox[n-maxInboxSize:]...)
+				}
+			}
+		}
+	}
+}
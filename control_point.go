@@ -1,11 +1,30 @@
 package avi
 
+import (
+	"errors"
+)
+
 const controlPointTexture = "control_point"
 
 type controlPoint struct {
 	objectT
 	points    float64
 	influence float64
+	// Optional scripted motion of the control point
+	mover mover
+
+	// Fleet that owns the control point and scores its points
+	owner string
+	// Fleet that progress has been made for
+	capturer string
+	// Capture progress of the capturer between 0 and 1
+	progress float64
+	// Whether multiple fleets are within the influence of the control point
+	contested bool
+	// Progress made per tick
+	captureRate float64
+	// Inactive control points cannot be captured and do not score
+	inactive bool
 }
 
 type ControlPointConf struct {
@@ -14,6 +33,16 @@ type ControlPointConf struct {
 	Position  []float64 `yaml:"position" json:"position"`
 	Points    float64   `yaml:"points" json:"points"`
 	Influence float64   `yaml:"influence" json:"influence"`
+	// Initial velocity of a free moving control point.
+	Velocity []float64 `yaml:"velocity" json:"velocity"`
+	// Path the control point follows, starting from its position.
+	Path PathConf `yaml:"path" json:"path"`
+	// Orbit the control point follows, starting from its position.
+	Orbit OrbitConf `yaml:"orbit" json:"orbit"`
+	// Time in seconds a lone fleet needs to capture the control point, zero means instantly.
+	CaptureTime float64 `yaml:"capture_time" json:"capture_time"`
+	// Whether the control point starts inactive, until activated by an event.
+	Inactive bool `yaml:"inactive" json:"inactive"`
 }
 
 func NewControlPoint(id ID, conf ControlPointConf) (*controlPoint, error) {
@@ -21,18 +50,119 @@ func NewControlPoint(id ID, conf ControlPointConf) (*controlPoint, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &controlPoint{
+	cp := &controlPoint{
 		objectT: objectT{
 			id:       id,
 			position: pos,
 			mass:     conf.Mass,
 			radius:   conf.Radius,
 		},
-		points:    conf.Points,
-		influence: conf.Influence,
-	}, nil
+		points:      conf.Points,
+		influence:   conf.Influence,
+		captureRate: 1,
+		inactive:    conf.Inactive,
+	}
+	if conf.CaptureTime < 0 {
+		return nil, errors.New("control point capture_time must not be negative")
+	}
+	if conf.CaptureTime > 0 {
+		cp.captureRate = SecondsPerTick / conf.CaptureTime
+	}
+	if len(conf.Velocity) > 0 {
+		cp.velocity, err = sliceToVec(conf.Velocity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hasPath := len(conf.Path.Waypoints) > 0
+	hasOrbit := conf.Orbit.Period != 0
+	switch {
+	case hasPath && hasOrbit:
+		return nil, errors.New("control point cannot have both a path and an orbit")
+	case hasPath:
+		cp.mover, err = newPathMover(pos, conf.Path)
+	case hasOrbit:
+		cp.mover, err = newOrbitMover(pos, conf.Orbit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Set the velocity of a scripted control point so
+// that it arrives at its next position after this tick.
+func (cp *controlPoint) move(tick int64) {
+	if cp.mover == nil {
+		return
+	}
+	next := cp.mover.position(float64(tick+1) * SecondsPerTick)
+	cp.setVelocity(next.Sub(cp.position).Mul(1 / SecondsPerTick))
 }
 
 func (controlPoint) Texture() string {
 	return controlPointTexture
 }
+
+func (cp *controlPoint) Owner() string {
+	return cp.owner
+}
+
+func (cp *controlPoint) Capturer() string {
+	return cp.capturer
+}
+
+func (cp *controlPoint) Progress() float64 {
+	return cp.progress
+}
+
+func (cp *controlPoint) Contested() bool {
+	return cp.contested
+}
+
+// Update the capture state given the fleets within the influence of the control point.
+func (cp *controlPoint) capture(fleets []string) {
+	cp.contested = len(fleets) > 1
+	if len(fleets) != 1 {
+		return
+	}
+	fleet := fleets[0]
+	if cp.progress == 0 {
+		cp.capturer = fleet
+	}
+	if cp.capturer == fleet {
+		cp.progress += cp.captureRate
+		if cp.progress >= 1 {
+			cp.progress = 1
+			cp.owner = fleet
+		}
+		return
+	}
+	// Undo the progress of the previous capturer first
+	cp.progress -= cp.captureRate
+	if cp.progress <= 0 {
+		cp.progress = 0
+		if cp.owner == cp.capturer {
+			cp.owner = ""
+		}
+		cp.capturer = fleet
+	}
+}
+
+// Find the distinct fleets with ships within the influence of the control point.
+func (cp *controlPoint) presentTeams(ships []*shipT, teams []string) []string {
+	influence2 := cp.influence * cp.influence
+ships:
+	for _, ship := range ships {
+		if ship.npc || LengthSq(cp.position.Sub(ship.position)) >= influence2 {
+			continue
+		}
+		for _, t := range teams {
+			if t == ship.team {
+				continue ships
+			}
+		}
+		teams = append(teams, ship.team)
+	}
+	return teams
+}
@@ -1,7 +1,6 @@
 package nathanielc
 
 import (
-	"math"
 	"math/rand"
 
 	"github.com/go-gl/mathgl/mgl64"
@@ -9,6 +8,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi"
 	"github.com/nathanielc/avi/nav"
+	"github.com/nathanielc/avi/target"
 )
 
 func init() {
@@ -23,19 +23,12 @@ type DubberHeadPilot struct {
 	fired         bool
 	navComputer   *nav.Nav
 	cooldownTicks int64
-	target        avi.ID
-	targetI       velPoint
-	targetF       velPoint
+	targets       *target.TargetComputer
 	ctlp          avi.ID
 	ctlpBias      mgl64.Vec3
 	ctlpBiasRand  *rand.Rand
 }
 
-type velPoint struct {
-	velocity mgl64.Vec3
-	tick     int64
-}
-
 func NewDubberHead() avi.Pilot {
 	seed++
 	ctlpBiasRand := rand.New(rand.NewSource(seed))
@@ -43,7 +36,6 @@ func NewDubberHead() avi.Pilot {
 	return &DubberHeadPilot{
 		dir:           mgl64.Vec3{1, 1, 1},
 		cooldownTicks: 1,
-		target:        avi.NilID,
 		ctlp:          avi.NilID,
 		ctlpBias:      n,
 		ctlpBiasRand:  ctlpBiasRand,
@@ -123,63 +115,27 @@ func (self *DubberHeadPilot) navCtlP(time int64, scan avi.ScanResult) {
 }
 
 func (self *DubberHeadPilot) fire(tick int64, scan avi.ScanResult) {
-
-	//Find target ship
-	if !shipExists(self.target, scan.Ships) {
-		distance := 0.0
-		for id, ship := range scan.Ships {
-			if ship.Fleet == self.Fleet {
-				continue
-			}
-			d := ship.Position.Sub(scan.Position).Len()
-			if d < distance || distance == 0 {
-				distance = d
-				self.target = id
-				self.targetI = velPoint{}
-			}
-		}
-	}
-	if !shipExists(self.target, scan.Ships) {
+	if self.targets == nil {
+		self.targets = target.NewTargetComputer(self.Team)
+		self.targets.MaxRange = 1000
+		self.targets.Sticky = true
+	}
+	self.targets.Update(tick, scan)
+	tr, ok := self.targets.Target(scan)
+	if !ok {
 		return
 	}
 
-	target := scan.Ships[self.target]
-	targetPos := target.Position
-	targetVel := target.Velocity
-
-	if avi.LengthSq(targetPos.Sub(scan.Position)) > 1e6 {
-		self.target = avi.NilID
-		if glog.V(3) {
-			glog.Infoln("Target is too far away choosing another target")
-		}
-	}
-
 	if tick%self.cooldownTicks == 0 {
-		self.targetF.tick = tick
-		self.targetF.velocity = targetVel
 		for _, weapon := range self.Weapons {
-			vel := weapon.GetAmmoVel()
-
-			acc := self.targetF.velocity.
-				Sub(self.targetI.velocity).
-				Mul(1.0 / (avi.SecondsPerTick * float64(self.targetF.tick-self.targetI.tick)))
-
-			if glog.V(4) {
-				glog.Infoln("Acc: ", acc)
-			}
-
-			deltaPos := targetPos.Sub(scan.Position)
-			deltaVel := targetVel.Sub(scan.Velocity)
-			time := calcT(deltaPos, deltaVel, vel)
-			if time < 0 {
+			dir, _, ok := self.targets.Aim(scan, tr, weapon.GetAmmoVel())
+			if !ok {
 				if glog.V(3) {
-					glog.Infoln("Target out of range", time)
+					glog.Infoln("Target out of range")
 				}
 				continue
 			}
 
-			dir := deltaVel.Add(deltaPos.Mul(1 / time)).Add(acc.Mul(time * 0.5))
-
 			if glog.V(3) {
 				glog.Infoln(dir, dir.Len())
 			}
@@ -192,49 +148,10 @@ func (self *DubberHeadPilot) fire(tick int64, scan avi.ScanResult) {
 			}
 			self.cooldownTicks = weapon.GetCoolDownTicks()
 		}
-		self.targetI.tick = tick
-		self.targetI.velocity = targetVel
 	}
 }
 
-func calcT(deltaPos, deltaVel mgl64.Vec3, va float64) float64 {
-
-	vt := deltaVel.Len()
-	x := deltaPos.Len()
-	nVel := deltaVel.Normalize()
-	nPos := deltaPos.Normalize()
-	ctheta := nPos.Dot(nVel)
-
-	a := va*va - vt*vt
-	b := 2 * x * vt * ctheta
-	c := -x * x
-
-	det := b*b - 4*a*c
-
-	if det < 0 {
-		return -1
-	}
-
-	t1 := (-b + math.Sqrt(det)) / (2 * a)
-	t2 := (-b - math.Sqrt(det)) / (2 * a)
-
-	if glog.V(4) {
-		glog.Infoln(deltaPos, deltaVel, va, vt, x, t1, t2)
-	}
-
-	if t1 < t2 && t1 > 0 || t2 < 0 {
-		return t1
-	}
-
-	return t2
-}
-
 func ctlpExists(target avi.ID, ctlps map[avi.ID]avi.CtlPSR) bool {
 	_, ok := ctlps[target]
 	return ok
 }
-
-func shipExists(target avi.ID, ships map[avi.ID]avi.ShipSR) bool {
-	_, ok := ships[target]
-	return ok
-}
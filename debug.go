@@ -0,0 +1,122 @@
+package avi
+
+import "github.com/go-gl/mathgl/mgl64"
+
+// Kinds of debug shapes pilots can draw.
+const (
+	DebugLine     = "line"
+	DebugSphere   = "sphere"
+	DebugLabel    = "label"
+	DebugWaypoint = "waypoint"
+	DebugTarget   = "target"
+)
+
+// A shape drawn by a pilot to show what it is thinking.
+// Shapes last until the pilot draws again in a later tick.
+type DebugShape struct {
+	Kind string
+	// Start of lines, centre of spheres and position of labels and waypoints.
+	Position mgl64.Vec3
+	// End of lines.
+	End    mgl64.Vec3
+	Radius float64
+	Text   string
+	// ID of the targeted object.
+	Target ID
+	// Color as an HTML hex string, empty uses the default for the kind.
+	Color string
+}
+
+// Drawers that implement DebugDrawer are sent the debug shapes drawn by
+// pilots each frame, keyed by the ID of the pilot's ship.
+// Pilots only draw shapes once the simulation's debugging is enabled.
+type DebugDrawer interface {
+	DrawDebug(t float64, shapes map[ID][]DebugShape)
+}
+
+// Pilots embedding GenericPilot record the shapes they draw.
+type debugPilot interface {
+	enableDebug()
+	startDebug()
+	debugShapes() []DebugShape
+}
+
+// Whether drawn debug shapes are recorded, pilots can skip expensive debug work when false.
+func (self *GenericPilot) Debugging() bool {
+	return self.debugging
+}
+
+// Draw a line between two points.
+func (self *GenericPilot) DebugLine(from, to mgl64.Vec3, color string) {
+	self.debugDraw(DebugShape{Kind: DebugLine, Position: from, End: to, Color: color})
+}
+
+// Draw a sphere.
+func (self *GenericPilot) DebugSphere(center mgl64.Vec3, radius float64, color string) {
+	self.debugDraw(DebugShape{Kind: DebugSphere, Position: center, Radius: radius, Color: color})
+}
+
+// Draw text at a position.
+func (self *GenericPilot) DebugLabel(pos mgl64.Vec3, text string) {
+	self.debugDraw(DebugShape{Kind: DebugLabel, Position: pos, Text: text})
+}
+
+// Show the waypoint the ship is flying to.
+func (self *GenericPilot) DebugWaypoint(pos mgl64.Vec3, tolerance float64) {
+	self.debugDraw(DebugShape{Kind: DebugWaypoint, Position: pos, Radius: tolerance})
+}
+
+// Show the object the pilot is targeting.
+func (self *GenericPilot) DebugTarget(id ID) {
+	self.debugDraw(DebugShape{Kind: DebugTarget, Target: id})
+}
+
+func (self *GenericPilot) debugDraw(s DebugShape) {
+	if !self.debugging {
+		return
+	}
+	// Replace the shapes of the last tick drawn in
+	if !self.drawing {
+		self.drawing = true
+		self.debug = self.debug[0:0]
+	}
+	self.debug = append(self.debug, s)
+}
+
+func (self *GenericPilot) enableDebug() {
+	self.debugging = true
+	// Respawned ships start without the shapes of their previous life
+	self.debug = self.debug[0:0]
+}
+
+func (self *GenericPilot) startDebug() {
+	self.drawing = false
+}
+
+func (self *GenericPilot) debugShapes() []DebugShape {
+	return self.debug
+}
+
+// Enable recording the debug shapes drawn by pilots, for streams that are DebugDrawers.
+// Recording is off by default as pilots may skip debug work when not Debugging.
+func (sim *Simulation) EnableDebug() {
+	sim.debug = true
+	for _, ship := range sim.ships {
+		if d, ok := ship.pilot.(debugPilot); ok {
+			d.enableDebug()
+		}
+	}
+}
+
+// Collect the last shapes drawn by each pilot.
+func (sim *Simulation) collectDebug() map[ID][]DebugShape {
+	shapes := make(map[ID][]DebugShape)
+	for _, ship := range sim.ships {
+		if d, ok := ship.pilot.(debugPilot); ok {
+			if s := d.debugShapes(); len(s) > 0 {
+				shapes[ship.id] = append([]DebugShape(nil), s...)
+			}
+		}
+	}
+	return shapes
+}
@@ -9,6 +9,30 @@ type Drawable interface {
 	Texture() string
 }
 
+// Drawables that are not spherical report their dimensions.
+type Sized interface {
+	Size() mgl64.Vec3
+}
+
+// Drawables that can be captured report their capture state.
+type Capturable interface {
+	Owner() string
+	Capturer() string
+	Progress() float64
+	Contested() bool
+}
+
+// Drawables attached to another object report their parent and offset from it.
+type Attached interface {
+	Parent() (ID, bool)
+	Offset() mgl64.Vec3
+}
+
+// Drawers that implement EventLogger are told about map events as they fire.
+type EventLogger interface {
+	LogEvent(t float64, name, action string)
+}
+
 type Drawer interface {
 	Draw(
 		t float64,
@@ -45,6 +45,11 @@ func NewEngineFromConf(pos mgl64.Vec3, conf EngineConf) *Engine {
 	}
 }
 
+// Energy produced per tick at full power.
+func (self *Engine) GetEnergy() float64 {
+	return self.energy
+}
+
 func (self *Engine) getOutput() float64 {
 	return self.currentOutput
 }
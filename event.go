@@ -0,0 +1,136 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Add the event's asteroid to the map, asteroids with a velocity make moving hazards.
+	EventSpawnAsteroid = "spawn_asteroid"
+	// Allow the target control point to be captured and score.
+	EventActivateControlPoint = "activate_control_point"
+	// Stop the target control point from being captured or scoring.
+	EventDeactivateControlPoint = "deactivate_control_point"
+	// Change the points of the target control point.
+	EventSetPoints = "set_points"
+	// Add the event's zone to the map.
+	EventOpenZone = "open_zone"
+	// Remove the target zone from the map.
+	EventCloseZone = "close_zone"
+	// Add the event's ship to the map as a neutral ship.
+	EventSpawnNPC = "spawn_npc"
+)
+
+// Conf format for scripted map events.
+// An event fires once, when all of its set conditions are met.
+type EventConf struct {
+	// Name of the event recorded in the replay.
+	Name   string `yaml:"name" json:"name"`
+	Action string `yaml:"action" json:"action"`
+	// Time in seconds after which the event fires.
+	Time float64 `yaml:"time" json:"time"`
+	// The event fires once any team's score reaches this value.
+	Score float64 `yaml:"score" json:"score"`
+	// The event fires once this many ships or fewer remain.
+	Ships int `yaml:"ships" json:"ships"`
+	// Index of the map control point or zone the action applies to.
+	Target   int          `yaml:"target" json:"target"`
+	Points   float64      `yaml:"points" json:"points"`
+	Asteroid AsteroidConf `yaml:"asteroid" json:"asteroid"`
+	Zone     ZoneConf     `yaml:"zone" json:"zone"`
+	Ship     ShipConf     `yaml:"ship" json:"ship"`
+}
+
+func (c EventConf) Validate() error {
+	switch c.Action {
+	case EventSpawnAsteroid, EventActivateControlPoint, EventDeactivateControlPoint,
+		EventSetPoints, EventOpenZone, EventCloseZone, EventSpawnNPC:
+	default:
+		return errors.New(fmt.Sprintf("unknown event action '%s'", c.Action))
+	}
+	if c.Time < 0 || c.Score < 0 || c.Ships < 0 {
+		return errors.New("event time, score and ships must not be negative")
+	}
+	if c.Time == 0 && c.Score == 0 && c.Ships == 0 {
+		return errors.New(fmt.Sprintf("event '%s' has no time, score or ships condition", c.Name))
+	}
+	return nil
+}
+
+type event struct {
+	conf  EventConf
+	fired bool
+}
+
+// Whether all of the event's conditions are met.
+func (e *event) ready(sim *Simulation) bool {
+	if e.conf.Time > 0 && float64(sim.tick)*SecondsPerTick < e.conf.Time {
+		return false
+	}
+	if e.conf.Score > 0 {
+		if _, score := sim.bestFleets(); score < e.conf.Score {
+			return false
+		}
+	}
+	if e.conf.Ships > 0 && len(sim.ships) > e.conf.Ships {
+		return false
+	}
+	return true
+}
+
+// Fire all events whose conditions are met.
+func (sim *Simulation) processEvents() {
+	for _, e := range sim.events {
+		if e.fired || !e.ready(sim) {
+			continue
+		}
+		e.fired = true
+		if err := sim.fireEvent(e.conf); err != nil {
+			glog.Errorf("Event '%s' failed: %s", e.conf.Name, err)
+			continue
+		}
+		if l, ok := sim.stream.(EventLogger); ok {
+			l.LogEvent(float64(sim.tick)*SecondsPerTick, e.conf.Name, e.conf.Action)
+		}
+	}
+}
+
+func (sim *Simulation) fireEvent(conf EventConf) error {
+	switch conf.Action {
+	case EventSpawnAsteroid:
+		sim.addAsteroid(conf.Asteroid)
+	case EventActivateControlPoint, EventDeactivateControlPoint, EventSetPoints:
+		if conf.Target < 0 || conf.Target >= len(sim.mapCtlps) {
+			return errors.New(fmt.Sprintf("unknown control point %d", conf.Target))
+		}
+		cp := sim.mapCtlps[conf.Target]
+		if cp == nil {
+			return errors.New(fmt.Sprintf("control point %d was not added", conf.Target))
+		}
+		switch conf.Action {
+		case EventActivateControlPoint:
+			cp.inactive = false
+		case EventDeactivateControlPoint:
+			cp.inactive = true
+		case EventSetPoints:
+			cp.points = conf.Points
+		}
+	case EventOpenZone:
+		sim.addZone(conf.Zone)
+	case EventSpawnNPC:
+		return sim.addNPC(conf.Ship)
+	case EventCloseZone:
+		if conf.Target < 0 || conf.Target >= len(sim.mapZones) {
+			return errors.New(fmt.Sprintf("unknown zone %d", conf.Target))
+		}
+		z := sim.mapZones[conf.Target]
+		if z == nil {
+			return errors.New(fmt.Sprintf("zone %d was not added", conf.Target))
+		}
+		sim.removeZone(z)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package avi
+
+import "github.com/go-gl/mathgl/mgl64"
+
+const (
+	defaultFlagMass   = 1000
+	defaultFlagRadius = 5
+)
+
+// A flag that ships can carry back to their base.
+type flagT struct {
+	objectT
+	attachmentT
+	team string
+	home mgl64.Vec3
+}
+
+// Scan result of a flag.
+type FlagSR struct {
+	ID       ID
+	Team     string
+	Position mgl64.Vec3
+	Velocity mgl64.Vec3
+	Radius   float64
+	Home     mgl64.Vec3
+	// Ship carrying the flag, NilID if the flag is not carried.
+	Carrier ID
+}
+
+func (f *flagT) Texture() string {
+	return "flag"
+}
+
+// Whether the flag is at rest at its home.
+func (f *flagT) isHome() bool {
+	return !f.attached && f.position == f.home
+}
+
+func (f *flagT) returnHome() {
+	f.position = f.home
+	f.velocity = mgl64.Vec3{}
+}
+
+func (f *flagT) scan() FlagSR {
+	carrier := ID(NilID)
+	if f.attached {
+		carrier = f.parent
+	}
+	return FlagSR{
+		ID:       f.id,
+		Team:     f.team,
+		Position: f.position,
+		Velocity: f.velocity,
+		Radius:   f.radius,
+		Home:     f.home,
+		Carrier:  carrier,
+	}
+}
+
+func (sim *Simulation) addFlag(team string, pos mgl64.Vec3, radius, mass float64) *flagT {
+	f := &flagT{
+		team: team,
+		home: pos,
+	}
+	f.id = sim.getNextID()
+	f.position = pos
+	f.radius = radius
+	f.mass = mass
+	f.parent = NilID
+	sim.flags = append(sim.flags, f)
+	sim.added[f.id] = f
+	return f
+}
+
+// Refresh the flag scan results shared by all sensors.
+func (sim *Simulation) scanFlags() {
+	if len(sim.flags) == 0 {
+		return
+	}
+	srs := make([]FlagSR, len(sim.flags))
+	for i, f := range sim.flags {
+		srs[i] = f.scan()
+	}
+	sim.flagSRs = srs
+}
@@ -1,6 +1,8 @@
 package avi
 
 type FleetConf struct {
-	Name  string     `yaml:"name" json:"name"`
+	Name string `yaml:"name" json:"name"`
+	// Fleets on the same team are allied, defaults to the fleet name.
+	Team  string     `yaml:"team" json:"team"`
 	Ships []ShipConf `yaml:"ships" json:"ships"`
 }
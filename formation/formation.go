@@ -0,0 +1,145 @@
+// Package formation helps the ships of a fleet fly in formation around a leader.
+package formation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/nav"
+)
+
+const (
+	// Members fly abreast of the leader, alternating left and right.
+	Line = "line"
+	// Members trail the leader in a V.
+	Wedge = "wedge"
+	// Members surround the leader on a sphere.
+	Sphere = "sphere"
+)
+
+// Slots are spaced this many ship diameters apart.
+const spacingMargin = 1.5
+
+// A Formation describes where members fly relative to their leader.
+type Formation struct {
+	Shape string
+	// Distance between neighbouring slots.
+	Spacing float64
+	// Number of members not counting the leader, used to size a sphere.
+	Size int
+}
+
+// Smallest spacing at which ships of the given radius cannot collide while holding their slots.
+func MinSpacing(radius float64) float64 {
+	return 2 * radius * spacingMargin
+}
+
+// New creates a formation for size members, spaced for ships no larger than radius.
+func New(shape string, size int, radius float64) (Formation, error) {
+	switch shape {
+	case Line, Wedge, Sphere:
+	default:
+		return Formation{}, errors.New(fmt.Sprintf("unknown formation shape '%s'", shape))
+	}
+	if size < 0 || radius <= 0 {
+		return Formation{}, errors.New("formation size must not be negative and radius must be positive")
+	}
+	return Formation{
+		Shape:   shape,
+		Spacing: MinSpacing(radius),
+		Size:    size,
+	}, nil
+}
+
+// Offset of a slot from the leader in the leader's frame,
+// where X is the direction of travel, Y is left and Z is up.
+func (f Formation) Offset(slot int) mgl64.Vec3 {
+	// Rank counts outwards from the leader, alternating sides
+	rank := float64(slot/2 + 1)
+	side := 1.0
+	if slot%2 == 1 {
+		side = -1
+	}
+	switch f.Shape {
+	case Line:
+		return mgl64.Vec3{0, side * rank * f.Spacing, 0}
+	case Wedge:
+		return mgl64.Vec3{-rank * f.Spacing, side * rank * f.Spacing, 0}
+	case Sphere:
+		return f.sphereOffset(slot)
+	}
+	return mgl64.Vec3{}
+}
+
+// Place slots evenly on a sphere around the leader using a Fibonacci lattice.
+func (f Formation) sphereOffset(slot int) mgl64.Vec3 {
+	n := f.Size
+	if n < 1 {
+		n = 1
+	}
+	// Large enough that neighbouring slots are at least Spacing apart
+	r := math.Max(f.Spacing, f.Spacing*math.Sqrt(float64(n))/2)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	z := 1 - (2*float64(slot)+1)/float64(n)
+	ring := math.Sqrt(1 - z*z)
+	theta := golden * float64(slot)
+	return mgl64.Vec3{ring * math.Cos(theta), ring * math.Sin(theta), z}.Mul(r)
+}
+
+// Position of the slot given the leader's position and velocity.
+// The formation faces the leader's direction of travel, or +X if the leader is stationary.
+func (f Formation) Slot(slot int, leaderPos, leaderVel mgl64.Vec3) mgl64.Vec3 {
+	forward := mgl64.Vec3{1, 0, 0}
+	if leaderVel.Len() > 0 {
+		forward = leaderVel.Normalize()
+	}
+	up := mgl64.Vec3{0, 0, 1}
+	if math.Abs(forward.Dot(up)) > 0.99 {
+		up = mgl64.Vec3{0, 1, 0}
+	}
+	left := up.Cross(forward).Normalize()
+	up = forward.Cross(left)
+
+	o := f.Offset(slot)
+	return leaderPos.
+		Add(forward.Mul(o.X())).
+		Add(left.Mul(o.Y())).
+		Add(up.Mul(o.Z()))
+}
+
+// Waypoint for nav to hold the slot, arriving at the leader's speed.
+func (f Formation) Waypoint(slot int, leaderPos, leaderVel mgl64.Vec3, tolerance float64) nav.Waypoint {
+	return nav.Waypoint{
+		Position:    f.Slot(slot, leaderPos, leaderVel),
+		Tolerance:   tolerance,
+		ArriveSpeed: leaderVel.Len(),
+	}
+}
+
+// FleetMates returns the IDs of the scanned ships in the fleet.
+func FleetMates(scan avi.ScanResult, fleet string) []avi.ID {
+	var ids []avi.ID
+	for id, ship := range scan.Ships {
+		if ship.Fleet == fleet {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Assign picks the fleet mate with the lowest ID as leader and gives every other ship a slot
+// in ID order, so all members agree without communicating. The leader's slot is -1.
+func Assign(self avi.ID, mates []avi.ID) (leader avi.ID, slot int) {
+	ids := append([]avi.ID{self}, mates...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if id == self {
+			return ids[0], i - 1
+		}
+	}
+	return ids[0], -1
+}
@@ -0,0 +1,106 @@
+package formation_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/formation"
+)
+
+func TestSpacing(t *testing.T) {
+	radius := 5.0
+	minDist := formation.MinSpacing(radius)
+	if minDist <= 2*radius {
+		t.Fatalf("spacing %f does not keep ships of radius %f apart", minDist, radius)
+	}
+	leaderPos := mgl64.Vec3{100, -50, 20}
+	leaderVel := mgl64.Vec3{3, 4, 1}
+	for _, shape := range []string{formation.Line, formation.Wedge, formation.Sphere} {
+		for _, size := range []int{1, 2, 7, 30} {
+			f, err := formation.New(shape, size, radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The leader is included as the last position
+			positions := make([]mgl64.Vec3, 0, size+1)
+			for i := 0; i < size; i++ {
+				positions = append(positions, f.Slot(i, leaderPos, leaderVel))
+			}
+			positions = append(positions, leaderPos)
+			for i := range positions {
+				for j := i + 1; j < len(positions); j++ {
+					if d := positions[i].Sub(positions[j]).Len(); d < minDist-1e-9 {
+						t.Errorf("%s of %d: positions %d and %d only %f apart", shape, size, i, j, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSlotFollowsLeader(t *testing.T) {
+	f, err := formation.New(formation.Wedge, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stationary leader faces +X, so wedge slots trail behind along -X
+	p := f.Slot(0, mgl64.Vec3{}, mgl64.Vec3{})
+	if p.X() >= 0 || p.Y() <= 0 {
+		t.Errorf("unexpected slot for stationary leader: %v", p)
+	}
+	// Leader flying along +Y, slots trail along -Y and the first slot is to the left
+	p = f.Slot(0, mgl64.Vec3{}, mgl64.Vec3{0, 10, 0})
+	if p.Y() >= 0 || p.X() >= 0 {
+		t.Errorf("unexpected slot for leader flying along +Y: %v", p)
+	}
+	// Flying straight up must still give a valid frame
+	p = f.Slot(1, mgl64.Vec3{}, mgl64.Vec3{0, 0, 10})
+	if math.IsNaN(p.X()) || p.Z() >= 0 {
+		t.Errorf("unexpected slot for leader flying along +Z: %v", p)
+	}
+
+	wp := f.Waypoint(0, mgl64.Vec3{}, mgl64.Vec3{0, 10, 0}, 1)
+	if wp.ArriveSpeed != 10 || wp.Tolerance != 1 {
+		t.Errorf("unexpected waypoint %v", wp)
+	}
+}
+
+func TestNewUnknownShape(t *testing.T) {
+	if _, err := formation.New("blob", 3, 1); err == nil {
+		t.Error("expected error for unknown shape")
+	}
+	if _, err := formation.New(formation.Line, 3, 0); err == nil {
+		t.Error("expected error for zero radius")
+	}
+}
+
+func TestAssign(t *testing.T) {
+	scan := avi.ScanResult{
+		Ships: map[avi.ID]avi.ShipSR{
+			3: {Fleet: "a"},
+			9: {Fleet: "a"},
+			1: {Fleet: "b"},
+		},
+	}
+	mates := formation.FleetMates(scan, "a")
+	if len(mates) != 2 {
+		t.Fatalf("unexpected fleet mates %v", mates)
+	}
+	testCases := []struct {
+		self   avi.ID
+		leader avi.ID
+		slot   int
+	}{
+		{self: 2, leader: 2, slot: -1},
+		{self: 5, leader: 3, slot: 0},
+		{self: 12, leader: 3, slot: 1},
+	}
+	for _, tc := range testCases {
+		leader, slot := formation.Assign(tc.self, mates)
+		if leader != tc.leader || slot != tc.slot {
+			t.Errorf("ship %d: got leader %d slot %d exp leader %d slot %d", tc.self, leader, slot, tc.leader, tc.slot)
+		}
+	}
+}
@@ -7,22 +7,34 @@ import (
 
 type GenericPilot struct {
 	Fleet     string
+	Team      string
 	Engines   []*Engine
 	Thrusters []*Thruster
 	Weapons   []*Weapon
 	Sensors   []*Sensor
+	Comms     []*Comms
+
+	// Debug shapes drawn the last tick the pilot drew any
+	debugging bool
+	drawing   bool
+	debug     []DebugShape
 }
 
 func (self *GenericPilot) JoinFleet(fleet string) {
 	self.Fleet = fleet
 }
 
+func (self *GenericPilot) JoinTeam(team string) {
+	self.Team = team
+}
+
 func (self *GenericPilot) LinkParts(shipParts []ShipPartConf, availableParts PartSetConf) ([]Part, error) {
 	parts := make([]Part, 0)
 	self.Engines = make([]*Engine, 0)
 	self.Thrusters = make([]*Thruster, 0)
 	self.Weapons = make([]*Weapon, 0)
 	self.Sensors = make([]*Sensor, 0)
+	self.Comms = make([]*Comms, 0)
 	for _, part := range shipParts {
 		switch part.Type {
 		case "engine":
@@ -73,6 +85,18 @@ func (self *GenericPilot) LinkParts(shipParts []ShipPartConf, availableParts Par
 				self.Sensors = append(self.Sensors, sensor)
 				parts = append(parts, sensor)
 			}
+		case "comms":
+			if commsConf, ok := availableParts.Comms[part.Name]; !ok {
+				return nil, PartNotAvailable(part.Name)
+			} else {
+				pos, err := sliceToVec(part.Position)
+				if err != nil {
+					return nil, err
+				}
+				comms := NewCommsFromConf(pos, commsConf)
+				self.Comms = append(self.Comms, comms)
+				parts = append(parts, comms)
+			}
 		default:
 			return nil, errors.New(fmt.Sprintf("Unknown part type '%s'", part.Type))
 		}
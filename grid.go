@@ -0,0 +1,71 @@
+package avi
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+type sector [3]int64
+
+// Spatial index of projectiles partitioned into cubic sectors.
+type projectileGrid struct {
+	size    float64
+	sectors map[sector][]*projectile
+}
+
+func newProjectileGrid() *projectileGrid {
+	return &projectileGrid{
+		sectors: make(map[sector][]*projectile),
+	}
+}
+
+// Clear the grid and index all projectiles with the given sector size.
+func (g *projectileGrid) index(projs []*projectile, size int64) {
+	for s, ps := range g.sectors {
+		if len(ps) == 0 {
+			delete(g.sectors, s)
+		} else {
+			g.sectors[s] = ps[0:0]
+		}
+	}
+	if size < 1 {
+		size = 1
+	}
+	g.size = float64(size)
+	for _, p := range projs {
+		s := g.sector(p.position)
+		g.sectors[s] = append(g.sectors[s], p)
+	}
+}
+
+func (g *projectileGrid) sector(pos mgl64.Vec3) sector {
+	return sector{
+		int64(math.Floor(pos.X() / g.size)),
+		int64(math.Floor(pos.Y() / g.size)),
+		int64(math.Floor(pos.Z() / g.size)),
+	}
+}
+
+// Call fn for every live projectile in the sectors that
+// overlap the sphere with the given position and radius.
+// The projectiles passed to fn may be slightly outside the sphere.
+func (g *projectileGrid) near(pos mgl64.Vec3, radius float64, fn func(*projectile)) {
+	if g.size == 0 {
+		return
+	}
+	r := mgl64.Vec3{radius, radius, radius}
+	min := g.sector(pos.Sub(r))
+	max := g.sector(pos.Add(r))
+	for x := min[0]; x <= max[0]; x++ {
+		for y := min[1]; y <= max[1]; y++ {
+			for z := min[2]; z <= max[2]; z++ {
+				for _, p := range g.sectors[sector{x, y, z}] {
+					if !p.dead {
+						fn(p)
+					}
+				}
+			}
+		}
+	}
+}
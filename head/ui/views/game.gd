@@ -16,6 +16,20 @@ var max_time = 0
 
 var objects = {}
 
+# Debug overlays drawn by pilots, toggled with the toggle_debug action
+const DEBUG_COLORS = {
+	"line": Color(1, 1, 1),
+	"sphere": Color(1, 1, 0),
+	"label": Color(0, 1, 1),
+	"waypoint": Color(0, 1, 0),
+	"target": Color(1, 0, 0),
+}
+const DEBUG_CIRCLE_SEGMENTS = 24
+var debug_visible = false
+var debug_shapes = []
+var debug_geom = null
+var debug_labels = []
+
 onready var time_slider = get_node("hud/time/slider")
 onready var time_max_label = get_node("hud/time/max")
 onready var time_curr_label = get_node("hud/time/current")
@@ -34,7 +48,19 @@ func _ready():
 	play_speed.connect("pressed", self, "_on_play_speed_pressed")
 	time_slider.connect("input_event", self, "_on_slider_input_event")
 	time_slider.set_step(0)
+	debug_geom = ImmediateGeometry.new()
+	var mat = FixedMaterial.new()
+	mat.set_fixed_flag(FixedMaterial.FLAG_USE_COLOR_ARRAY, true)
+	mat.set_flag(Material.FLAG_UNSHADED, true)
+	debug_geom.set_material_override(mat)
+	add_child(debug_geom)
 	set_process(true)
+	set_process_input(true)
+
+func _input(event):
+	if event.is_action_pressed("toggle_debug"):
+		debug_visible = !debug_visible
+		_draw_debug()
 
 func _request_frames(s):
 	last_frame = null
@@ -55,6 +81,8 @@ func _clear():
 		var obj = objects[id]
 		remove_child(obj)
 	objects = {}
+	debug_shapes = []
+	_draw_debug()
 
 func _process(delta):
 	if !dirty and mode == MODE_PAUSED:
@@ -94,28 +122,106 @@ func _process(delta):
 				var obj = objects[id]
 				remove_child(obj)
 				objects.erase(id)
+		var attached = []
 		for obj in frame['Objects']:
+			var objNode
 			if objects.has(obj['ID']):
-				var objNode = objects[obj['ID']]
-				objNode.set_translation(obj['Position'])
+				objNode = objects[obj['ID']]
 			else:
 				var s = load("res://models/"+obj['Model'] +".tscn")
-				var objNode
 				if s:
 					objNode = s.instance()
 				else:
 					objNode = preload("res://models/cube.tscn").instance()
 				add_child(objNode)
 				objects[obj['ID']] = objNode
-				objNode.set_translation(obj['Position'])
 				var r = obj['Radius']
 				if obj['Model'] == 'projectile':
 					r = r * 20
-				objNode.set_scale(Vector3(r,r,r))
+				if obj['Size'] != Vector3():
+					# Models span -1 to 1 so sized objects are scaled by half their dimensions
+					objNode.set_scale(obj['Size'] * 0.5)
+				else:
+					objNode.set_scale(Vector3(r,r,r))
+			if obj['Attached'] == 1:
+				attached.append(obj)
+			else:
+				objNode.set_translation(obj['Position'])
+		# Attached objects are positioned relative to their parent
+		for obj in attached:
+			var pos = obj['Position']
+			if objects.has(obj['Parent']):
+				pos += objects[obj['Parent']].get_translation()
+			objects[obj['ID']].set_translation(pos)
+		debug_shapes = []
+		if frame.has('Debug'):
+			debug_shapes = frame['Debug']
+		_draw_debug()
 		if dirty:
 			dirty = false
 			break
 
+func _debug_color(shape):
+	if shape['Color'] != "":
+		return Color(shape['Color'])
+	return DEBUG_COLORS[shape['Kind']]
+
+func _draw_debug():
+	debug_geom.clear()
+	for label in debug_labels:
+		get_node("hud").remove_child(label)
+	debug_labels = []
+	if !debug_visible or debug_shapes.empty():
+		return
+	var camera = get_node("Camera")
+	debug_geom.begin(Mesh.PRIMITIVE_LINES, null)
+	for shape in debug_shapes:
+		if !DEBUG_COLORS.has(shape['Kind']):
+			continue
+		debug_geom.set_color(_debug_color(shape))
+		var ship = null
+		if objects.has(shape['Ship']):
+			ship = objects[shape['Ship']].get_translation()
+		var kind = shape['Kind']
+		if kind == "line":
+			debug_geom.add_vertex(shape['Position'])
+			debug_geom.add_vertex(shape['End'])
+		elif kind == "sphere":
+			_draw_sphere(shape['Position'], shape['Radius'])
+		elif kind == "waypoint":
+			_draw_sphere(shape['Position'], shape['Radius'])
+			if ship != null:
+				debug_geom.add_vertex(ship)
+				debug_geom.add_vertex(shape['Position'])
+		elif kind == "target":
+			if ship != null and objects.has(shape['Target']):
+				debug_geom.add_vertex(ship)
+				debug_geom.add_vertex(objects[shape['Target']].get_translation())
+		elif kind == "label":
+			if camera.is_position_behind(shape['Position']):
+				continue
+			var label = Label.new()
+			label.set_text(shape['Text'])
+			label.add_color_override("font_color", _debug_color(shape))
+			label.set_pos(camera.unproject_position(shape['Position']))
+			get_node("hud").add_child(label)
+			debug_labels.append(label)
+	debug_geom.end()
+
+# Draw a sphere as three circles around its axes
+func _draw_sphere(c, r):
+	for i in range(DEBUG_CIRCLE_SEGMENTS):
+		var a0 = 2 * PI * i / DEBUG_CIRCLE_SEGMENTS
+		var a1 = 2 * PI * (i + 1) / DEBUG_CIRCLE_SEGMENTS
+		var p0 = Vector2(cos(a0), sin(a0)) * r
+		var p1 = Vector2(cos(a1), sin(a1)) * r
+		debug_geom.add_vertex(c + Vector3(p0.x, p0.y, 0))
+		debug_geom.add_vertex(c + Vector3(p1.x, p1.y, 0))
+		debug_geom.add_vertex(c + Vector3(p0.x, 0, p0.y))
+		debug_geom.add_vertex(c + Vector3(p1.x, 0, p1.y))
+		debug_geom.add_vertex(c + Vector3(0, p0.x, p0.y))
+		debug_geom.add_vertex(c + Vector3(0, p1.x, p1.y))
+
 func _update_slider(t, m):
 	if t > max_time:
 		max_time = t
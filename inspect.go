@@ -0,0 +1,50 @@
+package avi
+
+import "github.com/go-gl/mathgl/mgl64"
+
+// State of a ship in the simulation, for tests and tools.
+type ShipState struct {
+	ID       ID
+	Fleet    string
+	Team     string
+	Position mgl64.Vec3
+	Velocity mgl64.Vec3
+	Mass     float64
+	Radius   float64
+	Health   float64
+	// Number of the ship's projectiles that hit ships of other teams.
+	Hits  int
+	Pilot Pilot
+}
+
+// Advance the simulation a single tick without streaming it.
+// Reports the game mode's end condition, stepping past the end is allowed.
+func (sim *Simulation) Step() (Condition, bool) {
+	sim.doTick()
+	return sim.mode.End(sim)
+}
+
+// Number of ticks simulated so far.
+func (sim *Simulation) CurrentTick() int64 {
+	return sim.tick
+}
+
+// State of all ships alive in the simulation, in the order they were added.
+func (sim *Simulation) Ships() []ShipState {
+	states := make([]ShipState, len(sim.ships))
+	for i, ship := range sim.ships {
+		states[i] = ShipState{
+			ID:       ship.id,
+			Fleet:    ship.fleet,
+			Team:     ship.team,
+			Position: ship.position,
+			Velocity: ship.velocity,
+			Mass:     ship.mass,
+			Radius:   ship.radius,
+			Health:   ship.health,
+			Hits:     ship.hits,
+			Pilot:    ship.pilot,
+		}
+	}
+	return states
+}
@@ -61,7 +61,7 @@ func (self *JillPilot) Tick(tick int64) {
 	if !targetExists(self.target, scan.Ships) {
 		distance := 0.0
 		for id, ship := range scan.Ships {
-			if ship.Fleet == self.Fleet {
+			if ship.Team == self.Team {
 				continue
 			}
 			d := ship.Position.Sub(scan.Position).Len()
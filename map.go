@@ -1,14 +1,111 @@
 package avi
 
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	defaultImpulseToDamage = 0.25
+	defaultObjectCOR       = 0.7
+	defaultProjectileCOR   = 0.1
+	defaultMinSectorSize   = 100
+)
+
 type RulesConf struct {
+	// Game mode, one of 'king_of_the_hill', 'deathmatch', 'capture_the_flag',
+	// 'last_fleet_standing', 'race' or 'vip'. Defaults to 'king_of_the_hill'.
+	Mode         string  `yaml:"mode" json:"mode"`
 	Score        float64 `yaml:"score" json:"score"`
 	MaxFleetMass float64 `yaml:"max_fleet_mass" json:"max_fleet_mass"`
+	// Points awarded for destroying an enemy ship in deathmatch.
+	KillPoints float64 `yaml:"kill_points" json:"kill_points"`
+	// Maximum number of fleets on a team, zero means unlimited.
+	TeamSize int `yaml:"team_size" json:"team_size"`
+	// Multiplier for damage between ships of the same team, defaults to 1.
+	FriendlyFire *float64     `yaml:"friendly_fire" json:"friendly_fire"`
+	CTF          CTFConf      `yaml:"ctf" json:"ctf"`
+	Race         RaceConf     `yaml:"race" json:"race"`
+	VIP          VIPConf      `yaml:"vip" json:"vip"`
+	Respawn      RespawnConf  `yaml:"respawn" json:"respawn"`
+	Physics      PhysicsConf  `yaml:"physics" json:"physics"`
+	Boundary     BoundaryConf `yaml:"boundary" json:"boundary"`
+}
+
+// Physical constants used by the simulation.
+// Any value left unset is replaced with its default.
+type PhysicsConf struct {
+	// Conversion factor from the impulse lost during a collision to hull damage.
+	ImpulseToDamage *float64 `yaml:"impulse_to_damage" json:"impulse_to_damage"`
+	// Coefficient of restitution for collisions between ships and inert objects.
+	ObjectCOR *float64 `yaml:"object_cor" json:"object_cor"`
+	// Coefficient of restitution for collisions involving projectiles.
+	ProjectileCOR *float64 `yaml:"projectile_cor" json:"projectile_cor"`
+	// Smallest sector size used to partition space, zero uses the default.
+	MinSectorSize int64 `yaml:"min_sector_size" json:"min_sector_size"`
+	// Deprecated: use boundary mode. Either 'destroy' or 'ignore'.
+	OutOfBounds string `yaml:"out_of_bounds" json:"out_of_bounds"`
+}
+
+// Physical constants with defaults applied.
+type physicsT struct {
+	impulseToDamage float64
+	objectCOR       float64
+	projectileCOR   float64
+	minSectorSize   int64
+}
+
+func valueOr(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// Returns the constants with defaults applied to all unset values.
+func (c PhysicsConf) withDefaults() physicsT {
+	p := physicsT{
+		impulseToDamage: valueOr(c.ImpulseToDamage, defaultImpulseToDamage),
+		objectCOR:       valueOr(c.ObjectCOR, defaultObjectCOR),
+		projectileCOR:   valueOr(c.ProjectileCOR, defaultProjectileCOR),
+		minSectorSize:   c.MinSectorSize,
+	}
+	if p.minSectorSize == 0 {
+		p.minSectorSize = defaultMinSectorSize
+	}
+	return p
+}
+
+func (c PhysicsConf) Validate() error {
+	if c.ImpulseToDamage != nil && *c.ImpulseToDamage < 0 {
+		return errors.New(fmt.Sprintf("impulse_to_damage must not be negative: %f", *c.ImpulseToDamage))
+	}
+	if c.ObjectCOR != nil && (*c.ObjectCOR < 0 || *c.ObjectCOR > 1) {
+		return errors.New(fmt.Sprintf("object_cor must be between 0 and 1: %f", *c.ObjectCOR))
+	}
+	if c.ProjectileCOR != nil && (*c.ProjectileCOR < 0 || *c.ProjectileCOR > 1) {
+		return errors.New(fmt.Sprintf("projectile_cor must be between 0 and 1: %f", *c.ProjectileCOR))
+	}
+	if c.MinSectorSize < 0 {
+		return errors.New(fmt.Sprintf("min_sector_size must not be negative: %d", c.MinSectorSize))
+	}
+	switch c.OutOfBounds {
+	case "", BoundaryDestroy, BoundaryIgnore:
+	default:
+		return errors.New(fmt.Sprintf("unknown out_of_bounds rule '%s'", c.OutOfBounds))
+	}
+	return nil
 }
 
 type MapConf struct {
-	Radius         int64              `yaml:"radius" json:"radius"`
-	Asteroids      []AsteroidConf     `yaml:"asteroids" json:"asteroids"`
-	ControlPoints  []ControlPointConf `yaml:"control_points" json:"control_points"`
-	StartingPoints [][]float64        `yaml:"starting_points" json:"starting_points"`
-	Rules          RulesConf          `yaml:"rules" json:"rules"`
+	Radius        int64              `yaml:"radius" json:"radius"`
+	Asteroids     []AsteroidConf     `yaml:"asteroids" json:"asteroids"`
+	ControlPoints []ControlPointConf `yaml:"control_points" json:"control_points"`
+	Zones         []ZoneConf         `yaml:"zones" json:"zones"`
+	Checkpoints   []CheckpointConf   `yaml:"checkpoints" json:"checkpoints"`
+	Events        []EventConf        `yaml:"events" json:"events"`
+	// Neutral ships that belong to no fleet.
+	NPCs           []ShipConf  `yaml:"npcs" json:"npcs"`
+	StartingPoints [][]float64 `yaml:"starting_points" json:"starting_points"`
+	Rules          RulesConf   `yaml:"rules" json:"rules"`
 }
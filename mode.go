@@ -0,0 +1,559 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/golang/glog"
+)
+
+const (
+	ModeKingOfTheHill     = "king_of_the_hill"
+	ModeDeathmatch        = "deathmatch"
+	ModeCaptureTheFlag    = "capture_the_flag"
+	ModeLastFleetStanding = "last_fleet_standing"
+	ModeRace              = "race"
+	ModeVIP               = "vip"
+)
+
+const (
+	defaultKillPoints   = 1
+	defaultBaseRadius   = 100
+	defaultFlagPoints   = 1
+	defaultLaps         = 1
+	defaultEscapePoints = 1
+)
+
+const exitTexture = "exit"
+
+// A GameMode defines how teams score and when the game ends.
+// Fleets not on a team are their own team.
+type GameMode interface {
+	// Score is called once at the start of every tick.
+	Score(sim *Simulation)
+	// Killed is called when a ship is destroyed.
+	// The killer is the team that last damaged the ship, empty if unknown.
+	Killed(sim *Simulation, ship ID, team, killer string)
+	// Collided is called when two objects collide.
+	Collided(sim *Simulation, obj1, obj2 Object)
+	// End reports whether the game has ended and why.
+	End(sim *Simulation) (Condition, bool)
+}
+
+type gameModeFactory func(RulesConf) (GameMode, error)
+
+var registeredGameModes = make(map[string]gameModeFactory)
+
+// Register a game mode to make it available to maps
+func RegisterGameMode(mode string, gf gameModeFactory) {
+	registeredGameModes[mode] = gf
+}
+
+// Create the game mode selected by the rules, defaults to king of the hill.
+func newGameMode(rules RulesConf) (GameMode, error) {
+	mode := rules.Mode
+	if mode == "" {
+		mode = ModeKingOfTheHill
+	}
+	gf, ok := registeredGameModes[mode]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown game mode '%s'", mode))
+	}
+	return gf(rules)
+}
+
+func init() {
+	RegisterGameMode(ModeKingOfTheHill, newKingOfTheHill)
+	RegisterGameMode(ModeDeathmatch, newDeathmatch)
+	RegisterGameMode(ModeCaptureTheFlag, newCaptureTheFlag)
+	RegisterGameMode(ModeLastFleetStanding, newLastFleetStanding)
+	RegisterGameMode(ModeRace, newRace)
+	RegisterGameMode(ModeVIP, newVIP)
+}
+
+// Checks the end conditions shared by all game modes.
+func (sim *Simulation) commonEnd() (string, bool) {
+	switch {
+	case sim.tick >= sim.maxTicks:
+		return "max ticks reached", true
+	case len(sim.survivingTeams()) == 0:
+		return "all ships have been destroyed", true
+	}
+	return "", false
+}
+
+// Reports whether at most one team remains with no neutral ships left to fight,
+// so practice maps with a single fleet keep running until the NPCs are destroyed.
+func (sim *Simulation) oneTeamLeft() bool {
+	return len(sim.survivingTeams()) <= 1 && !sim.npcsRemain()
+}
+
+// Names of the teams with ships still alive or respawning, in sorted order.
+func (sim *Simulation) survivingTeams() []string {
+	var teams []string
+	for team, n := range sim.survivors {
+		if n > 0 || sim.respawning(team) {
+			teams = append(teams, team)
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// Ends the game once the score is reached, or once a single
+// team survives, has the best score and no neutral ships remain.
+func (sim *Simulation) scoreEnd() (Condition, bool) {
+	bestFleets, score := sim.bestFleets()
+	c := Condition{
+		Winners: bestFleets,
+		Score:   score,
+	}
+	if reason, end := sim.commonEnd(); end {
+		c.Reason = reason
+		return c, true
+	}
+	if score > sim.maxScore {
+		c.Reason = "max score reached"
+		return c, true
+	}
+	survivors := sim.survivingTeams()
+	if sim.oneTeamLeft() && len(survivors) == 1 && len(bestFleets) == 1 && bestFleets[0] == survivors[0] {
+		c.Reason = "last surviving team has best score"
+		return c, true
+	}
+	return c, false
+}
+
+// Fleets score points for owning uncontested control points.
+type kingOfTheHill struct {
+	teams []string
+}
+
+func newKingOfTheHill(RulesConf) (GameMode, error) {
+	return &kingOfTheHill{}, nil
+}
+
+func (m *kingOfTheHill) Score(sim *Simulation) {
+	for _, cp := range sim.ctlps {
+		if cp.inactive {
+			continue
+		}
+		m.teams = cp.presentTeams(sim.ships, m.teams[0:0])
+		cp.capture(m.teams)
+		// Only an uncontested owner scores
+		if cp.owner != "" && !cp.contested {
+			sim.scores[cp.owner] += cp.points * SecondsPerTick
+		}
+	}
+}
+
+func (m *kingOfTheHill) Killed(*Simulation, ID, string, string) {}
+
+func (m *kingOfTheHill) Collided(*Simulation, Object, Object) {}
+
+func (m *kingOfTheHill) End(sim *Simulation) (Condition, bool) {
+	return sim.scoreEnd()
+}
+
+// Fleets score points for destroying enemy ships.
+type deathmatch struct {
+	killPoints float64
+}
+
+func newDeathmatch(rules RulesConf) (GameMode, error) {
+	if rules.KillPoints < 0 {
+		return nil, errors.New("kill_points must not be negative")
+	}
+	m := &deathmatch{
+		killPoints: rules.KillPoints,
+	}
+	if m.killPoints == 0 {
+		m.killPoints = defaultKillPoints
+	}
+	return m, nil
+}
+
+func (m *deathmatch) Score(*Simulation) {}
+
+func (m *deathmatch) Killed(sim *Simulation, ship ID, team, killer string) {
+	if killer != "" && killer != team {
+		sim.scores[killer] += m.killPoints
+	}
+}
+
+func (m *deathmatch) Collided(*Simulation, Object, Object) {}
+
+func (m *deathmatch) End(sim *Simulation) (Condition, bool) {
+	c, end := sim.scoreEnd()
+	if !end && sim.oneTeamLeft() {
+		c.Reason = "only one team remains"
+		end = true
+	}
+	return c, end
+}
+
+// The last team with surviving ships wins, scores are the number of surviving ships.
+type lastFleetStanding struct{}
+
+func newLastFleetStanding(RulesConf) (GameMode, error) {
+	return lastFleetStanding{}, nil
+}
+
+func (lastFleetStanding) Score(sim *Simulation) {
+	for team, n := range sim.survivors {
+		sim.scores[team] = float64(n)
+	}
+}
+
+func (lastFleetStanding) Killed(*Simulation, ID, string, string) {}
+
+func (lastFleetStanding) Collided(*Simulation, Object, Object) {}
+
+func (lastFleetStanding) End(sim *Simulation) (Condition, bool) {
+	bestFleets, score := sim.bestFleets()
+	c := Condition{
+		Winners: bestFleets,
+		Score:   score,
+	}
+	if reason, end := sim.commonEnd(); end {
+		c.Reason = reason
+		return c, true
+	}
+	if sim.oneTeamLeft() {
+		c.Winners = sim.survivingTeams()
+		c.Reason = "last fleet standing"
+		return c, true
+	}
+	return c, false
+}
+
+// Conf format for capture the flag rules.
+type CTFConf struct {
+	// Radius of the base around each team's starting point.
+	BaseRadius float64 `yaml:"base_radius" json:"base_radius"`
+	// Points scored for each flag captured.
+	Points float64 `yaml:"points" json:"points"`
+	// Mass added to the ship carrying a flag.
+	FlagMass float64 `yaml:"flag_mass" json:"flag_mass"`
+	// Radius of the flags.
+	FlagRadius float64 `yaml:"flag_radius" json:"flag_radius"`
+}
+
+// Game modes that implement GameModeStarter are started once all fleets have been added.
+type GameModeStarter interface {
+	Start(sim *Simulation)
+}
+
+// Each team has a flag at its base. Ships pick up an enemy flag by touching it
+// and score by bringing it back to their own base while their own flag is at home.
+// Destroyed carriers drop the flag, touching your own dropped flag returns it home.
+type captureTheFlag struct {
+	conf  CTFConf
+	flags map[string]*flagT
+	teams []string
+}
+
+func newCaptureTheFlag(rules RulesConf) (GameMode, error) {
+	conf := rules.CTF
+	if conf.BaseRadius < 0 || conf.Points < 0 || conf.FlagMass < 0 || conf.FlagRadius < 0 {
+		return nil, errors.New("ctf base_radius, points, flag_mass and flag_radius must not be negative")
+	}
+	if conf.BaseRadius == 0 {
+		conf.BaseRadius = defaultBaseRadius
+	}
+	if conf.Points == 0 {
+		conf.Points = defaultFlagPoints
+	}
+	if conf.FlagMass == 0 {
+		conf.FlagMass = defaultFlagMass
+	}
+	if conf.FlagRadius == 0 {
+		conf.FlagRadius = defaultFlagRadius
+	}
+	return &captureTheFlag{
+		conf:  conf,
+		flags: make(map[string]*flagT),
+	}, nil
+}
+
+// Place a flag at the base of each team.
+func (m *captureTheFlag) Start(sim *Simulation) {
+	for team := range sim.bases {
+		m.teams = append(m.teams, team)
+	}
+	sort.Strings(m.teams)
+	for _, team := range m.teams {
+		m.flags[team] = sim.addFlag(team, sim.bases[team], m.conf.FlagRadius, m.conf.FlagMass)
+	}
+}
+
+func (m *captureTheFlag) inBase(pos, base mgl64.Vec3) bool {
+	return LengthSq(pos.Sub(base)) < m.conf.BaseRadius*m.conf.BaseRadius
+}
+
+func (m *captureTheFlag) carrying(sim *Simulation, ship *shipT) bool {
+	for _, flag := range m.flags {
+		if parent, ok := sim.attachedTo(flag); ok && parent == ship {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *captureTheFlag) Score(sim *Simulation) {
+	for _, team := range m.teams {
+		flag := m.flags[team]
+		if _, carried := sim.attachedTo(flag); carried {
+			m.capture(sim, flag)
+			continue
+		}
+		for _, ship := range sim.ships {
+			r := ship.radius + flag.radius
+			if ship.npc || LengthSq(ship.position.Sub(flag.position)) >= r*r {
+				continue
+			}
+			if ship.team == flag.team {
+				flag.returnHome()
+				continue
+			}
+			if !m.carrying(sim, ship) {
+				sim.attach(flag, ship, mgl64.Vec3{0, 0, ship.radius + flag.radius})
+				break
+			}
+		}
+	}
+}
+
+// Score a carried flag if the carrier is in its base and its own flag is at home.
+func (m *captureTheFlag) capture(sim *Simulation, flag *flagT) {
+	parent, _ := sim.attachedTo(flag)
+	ship, ok := parent.(*shipT)
+	if !ok {
+		return
+	}
+	if own, ok := m.flags[ship.team]; ok && !own.isHome() {
+		return
+	}
+	if base, ok := sim.bases[ship.team]; ok && m.inBase(ship.position, base) {
+		sim.scores[ship.team] += m.conf.Points
+		sim.detach(flag)
+		flag.returnHome()
+	}
+}
+
+func (m *captureTheFlag) Killed(*Simulation, ID, string, string) {}
+
+func (m *captureTheFlag) Collided(*Simulation, Object, Object) {}
+
+func (m *captureTheFlag) End(sim *Simulation) (Condition, bool) {
+	return sim.scoreEnd()
+}
+
+// Conf format for race rules.
+type RaceConf struct {
+	// Number of laps through the checkpoints needed to finish, defaults to 1.
+	Laps int `yaml:"laps" json:"laps"`
+}
+
+// Result of a ship that finished a race.
+type RaceResult struct {
+	Ship  ID
+	Fleet string
+	Team  string
+	// Time in seconds taken for each lap.
+	LapTimes []float64
+	// Total time in seconds taken to finish.
+	Time float64
+}
+
+// Ships race through the map's checkpoints in order, teams score a point for each checkpoint passed.
+// The team of the first ship to finish wins and the game ends once every ship has finished.
+type race struct {
+	laps     int
+	lapTimes map[ID][]float64
+	lapStart map[ID]int64
+	results  []RaceResult
+}
+
+func newRace(rules RulesConf) (GameMode, error) {
+	laps := rules.Race.Laps
+	if laps < 0 {
+		return nil, errors.New(fmt.Sprintf("race laps must not be negative: %d", laps))
+	}
+	if laps == 0 {
+		laps = defaultLaps
+	}
+	return &race{
+		laps:     laps,
+		lapTimes: make(map[ID][]float64),
+		lapStart: make(map[ID]int64),
+	}, nil
+}
+
+func (m *race) Score(sim *Simulation) {
+	n := len(sim.checkpoints)
+	if n == 0 {
+		return
+	}
+	for _, ship := range sim.ships {
+		if ship.npc || ship.finished || !sim.checkpoints[ship.nextCheckpoint].contains(ship.position) {
+			continue
+		}
+		sim.scores[ship.team]++
+		ship.nextCheckpoint++
+		if ship.nextCheckpoint < n {
+			continue
+		}
+		// Completed a lap
+		ship.nextCheckpoint = 0
+		ship.lap++
+		start, ok := m.lapStart[ship.id]
+		if !ok {
+			start = ship.spawned
+		}
+		m.lapTimes[ship.id] = append(m.lapTimes[ship.id], float64(sim.tick-start)*SecondsPerTick)
+		m.lapStart[ship.id] = sim.tick
+		if ship.lap == m.laps {
+			ship.finished = true
+			m.results = append(m.results, RaceResult{
+				Ship:     ship.id,
+				Fleet:    ship.fleet,
+				Team:     ship.team,
+				LapTimes: m.lapTimes[ship.id],
+				Time:     float64(sim.tick-ship.spawned) * SecondsPerTick,
+			})
+		}
+	}
+}
+
+func (m *race) Killed(*Simulation, ID, string, string) {}
+
+func (m *race) Collided(*Simulation, Object, Object) {}
+
+func (m *race) End(sim *Simulation) (Condition, bool) {
+	bestFleets, score := sim.bestFleets()
+	c := Condition{
+		Winners: bestFleets,
+		Score:   score,
+		Results: m.results,
+	}
+	if len(m.results) > 0 {
+		winner := m.results[0].Team
+		c.Winners = []string{winner}
+		c.Score = sim.scores[winner]
+	}
+	if reason, end := sim.commonEnd(); end {
+		c.Reason = reason
+		return c, true
+	}
+	for _, ship := range sim.ships {
+		if !ship.npc && !ship.finished {
+			return c, false
+		}
+	}
+	c.Reason = "all ships finished the race"
+	return c, true
+}
+
+// Conf format for VIP rules.
+type VIPConf struct {
+	// Region VIPs escape through, no exit means VIPs must survive.
+	// The exit is listed in the scan checkpoints.
+	Exit CheckpointConf `yaml:"exit" json:"exit"`
+	// Points scored when a team's VIP escapes.
+	EscapePoints float64 `yaml:"escape_points" json:"escape_points"`
+	// Points scored for destroying an enemy VIP.
+	KillPoints float64 `yaml:"kill_points" json:"kill_points"`
+}
+
+// Each fleet escorts its VIP ship to the exit while destroying enemy VIPs.
+// With an exit the game ends once every VIP has escaped or been destroyed,
+// otherwise it ends once at most one VIP remains in play.
+type vip struct {
+	conf VIPConf
+	exit *checkpoint
+	// Team of each VIP ship still in play
+	vips map[ID]string
+	// VIPs that have escaped or been destroyed
+	done map[ID]bool
+}
+
+func newVIP(rules RulesConf) (GameMode, error) {
+	conf := rules.VIP
+	if conf.EscapePoints < 0 || conf.KillPoints < 0 {
+		return nil, errors.New("vip escape_points and kill_points must not be negative")
+	}
+	if conf.EscapePoints == 0 {
+		conf.EscapePoints = defaultEscapePoints
+	}
+	if conf.KillPoints == 0 {
+		conf.KillPoints = defaultKillPoints
+	}
+	return &vip{
+		conf: conf,
+		vips: make(map[ID]string),
+		done: make(map[ID]bool),
+	}, nil
+}
+
+func (m *vip) Start(sim *Simulation) {
+	if m.conf.Exit.Radius == 0 {
+		return
+	}
+	exit := m.conf.Exit
+	if exit.Texture == "" {
+		exit.Texture = exitTexture
+	}
+	if err := sim.addCheckpoint(len(sim.checkpoints), exit); err != nil {
+		glog.Error(err)
+		return
+	}
+	m.exit = sim.checkpoints[len(sim.checkpoints)-1]
+}
+
+func (m *vip) Score(sim *Simulation) {
+	for _, ship := range sim.ships {
+		if !ship.vip || m.done[ship.id] {
+			continue
+		}
+		m.vips[ship.id] = ship.team
+		if m.exit != nil && m.exit.contains(ship.position) {
+			sim.scores[ship.team] += m.conf.EscapePoints
+			m.done[ship.id] = true
+			delete(m.vips, ship.id)
+		}
+	}
+}
+
+func (m *vip) Killed(sim *Simulation, ship ID, team, killer string) {
+	if _, ok := m.vips[ship]; !ok {
+		return
+	}
+	if killer != "" && killer != team {
+		sim.scores[killer] += m.conf.KillPoints
+	}
+	m.done[ship] = true
+	delete(m.vips, ship)
+}
+
+func (m *vip) Collided(*Simulation, Object, Object) {}
+
+func (m *vip) End(sim *Simulation) (Condition, bool) {
+	bestFleets, score := sim.bestFleets()
+	c := Condition{
+		Winners: bestFleets,
+		Score:   score,
+	}
+	if reason, end := sim.commonEnd(); end {
+		c.Reason = reason
+		return c, true
+	}
+	left := len(m.vips)
+	if m.exit != nil && left == 0 || m.exit == nil && len(m.done) > 0 && left <= 1 {
+		c.Reason = "no VIPs left to escort"
+		return c, true
+	}
+	return c, false
+}
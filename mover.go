@@ -0,0 +1,130 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Conf format for a scripted path through a list of waypoints.
+type PathConf struct {
+	Waypoints [][]float64 `yaml:"waypoints" json:"waypoints"`
+	// Speed in meters per second along the path.
+	Speed float64 `yaml:"speed" json:"speed"`
+	// Return to the starting position and repeat the path forever.
+	Loop bool `yaml:"loop" json:"loop"`
+}
+
+// Conf format for a circular orbit around a center point.
+type OrbitConf struct {
+	Center []float64 `yaml:"center" json:"center"`
+	// Axis of rotation, defaults to the z axis.
+	Axis []float64 `yaml:"axis" json:"axis"`
+	// Time in seconds for a complete orbit, negative values orbit in reverse.
+	Period float64 `yaml:"period" json:"period"`
+}
+
+// A mover determines the position of a kinematic object over time.
+type mover interface {
+	// Position of the object at time t in seconds.
+	position(t float64) mgl64.Vec3
+}
+
+type pathMover struct {
+	points []mgl64.Vec3
+	// Cumulative distance along the path to each point
+	distances []float64
+	speed     float64
+	loop      bool
+}
+
+func newPathMover(start mgl64.Vec3, conf PathConf) (*pathMover, error) {
+	if conf.Speed <= 0 {
+		return nil, errors.New(fmt.Sprintf("path speed must be positive: %f", conf.Speed))
+	}
+	m := &pathMover{
+		points:    []mgl64.Vec3{start},
+		distances: []float64{0},
+		speed:     conf.Speed,
+		loop:      conf.Loop,
+	}
+	for _, wp := range conf.Waypoints {
+		p, err := sliceToVec(wp)
+		if err != nil {
+			return nil, err
+		}
+		m.add(p)
+	}
+	if m.loop {
+		m.add(start)
+	}
+	return m, nil
+}
+
+func (m *pathMover) add(p mgl64.Vec3) {
+	last := len(m.points) - 1
+	d := m.distances[last] + p.Sub(m.points[last]).Len()
+	m.points = append(m.points, p)
+	m.distances = append(m.distances, d)
+}
+
+func (m *pathMover) position(t float64) mgl64.Vec3 {
+	total := m.distances[len(m.distances)-1]
+	if total == 0 {
+		return m.points[0]
+	}
+	s := m.speed * t
+	if m.loop {
+		s = math.Mod(s, total)
+	} else if s >= total {
+		return m.points[len(m.points)-1]
+	}
+	for i := 1; i < len(m.points); i++ {
+		if s <= m.distances[i] {
+			segment := m.distances[i] - m.distances[i-1]
+			if segment == 0 {
+				return m.points[i]
+			}
+			f := (s - m.distances[i-1]) / segment
+			return m.points[i-1].Add(m.points[i].Sub(m.points[i-1]).Mul(f))
+		}
+	}
+	return m.points[len(m.points)-1]
+}
+
+type orbitMover struct {
+	center mgl64.Vec3
+	offset mgl64.Vec3
+	axis   mgl64.Vec3
+	period float64
+}
+
+func newOrbitMover(start mgl64.Vec3, conf OrbitConf) (*orbitMover, error) {
+	center, err := sliceToVec(conf.Center)
+	if err != nil {
+		return nil, err
+	}
+	axis := mgl64.Vec3{0, 0, 1}
+	if len(conf.Axis) > 0 {
+		axis, err = sliceToVec(conf.Axis)
+		if err != nil {
+			return nil, err
+		}
+		if axis.Len() < small {
+			return nil, errors.New("orbit axis must not be zero")
+		}
+	}
+	return &orbitMover{
+		center: center,
+		offset: start.Sub(center),
+		axis:   axis.Normalize(),
+		period: conf.Period,
+	}, nil
+}
+
+func (m *orbitMover) position(t float64) mgl64.Vec3 {
+	angle := 2 * math.Pi * t / m.period
+	return m.center.Add(mgl64.QuatRotate(angle, m.axis).Rotate(m.offset))
+}
@@ -0,0 +1,49 @@
+package nathanielc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi/avitest"
+	_ "github.com/nathanielc/avi/nathanielc"
+)
+
+const jimMap = `
+control_points:
+  - {position: [0, 0, 200], radius: 10, mass: 1e6, points: 1, influence: 100}
+`
+
+const jimFleet = `
+name: gophers
+ships:
+  - pilot: jim
+    position: [0, 0, 0]
+    hull_strength: 150
+    parts:
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+      - {name: rocket, type: thruster, position: [20, 0, 0]}
+      - {name: rocket, type: thruster, position: [-20, 0, 0]}
+      - {name: rifle, type: weapon, position: [0, 15, 0]}
+      - {name: antenna, type: sensor, position: [0, 0, -12]}
+`
+
+const target = `
+position: [300, 0, 0]
+hull_strength: 1000
+parts:
+  - {name: nuclear, type: engine, position: [0, 0, 0]}
+`
+
+func TestJimHoldsControlPoint(t *testing.T) {
+	s := avitest.New(t, jimMap, jimFleet)
+	jim := s.Fleet("gophers")[0]
+	s.AssertWithin(20*time.Second, avitest.Reached(jim.ID, mgl64.Vec3{0, 0, 200}, 100), "reached control point")
+}
+
+func TestJimHitsTarget(t *testing.T) {
+	s := avitest.New(t, jimMap, jimFleet)
+	jim := s.Fleet("gophers")[0]
+	s.AddScripted("targets", target, nil)
+	s.AssertWithin(10*time.Second, avitest.Hit(jim.ID, 1), "hit target")
+}
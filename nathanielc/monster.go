@@ -5,6 +5,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi"
 	"github.com/nathanielc/avi/nav"
+	"github.com/nathanielc/avi/target"
 )
 
 func init() {
@@ -17,9 +18,7 @@ type MonsterPilot struct {
 	fired         bool
 	navComputer   *nav.Nav
 	cooldownTicks int64
-	target        avi.ID
-	targetI       velPoint
-	targetF       velPoint
+	targets       *target.TargetComputer
 	ctlp          avi.ID
 }
 
@@ -27,7 +26,6 @@ func NewMonster() avi.Pilot {
 	return &MonsterPilot{
 		dir:           mgl64.Vec3{1, 1, 1},
 		cooldownTicks: 1,
-		target:        avi.NilID,
 		ctlp:          avi.NilID,
 	}
 }
@@ -102,63 +100,27 @@ func (self *MonsterPilot) navCtlP(scan avi.ScanResult) {
 }
 
 func (self *MonsterPilot) fire(tick int64, scan avi.ScanResult) {
-
-	//Find target ship
-	if !shipExists(self.target, scan.Ships) {
-		distance := 0.0
-		for id, ship := range scan.Ships {
-			if ship.Fleet == self.Fleet {
-				continue
-			}
-			d := ship.Position.Sub(scan.Position).Len()
-			if d < distance || distance == 0 {
-				distance = d
-				self.target = id
-				self.targetI = velPoint{}
-			}
-		}
+	if self.targets == nil {
+		self.targets = target.NewTargetComputer(self.Team)
+		self.targets.MaxRange = 1000
+		self.targets.Sticky = true
 	}
-	if !shipExists(self.target, scan.Ships) {
+	self.targets.Update(tick, scan)
+	tr, ok := self.targets.Target(scan)
+	if !ok {
 		return
 	}
 
-	target := scan.Ships[self.target]
-	targetPos := target.Position
-	targetVel := target.Velocity
-
-	if avi.LengthSq(targetPos.Sub(scan.Position)) > 1e6 {
-		self.target = avi.NilID
-		if glog.V(3) {
-			glog.Infoln("Target is too far away choosing another target")
-		}
-	}
-
 	if tick%self.cooldownTicks == 0 {
-		self.targetF.tick = tick
-		self.targetF.velocity = targetVel
 		for _, weapon := range self.Weapons {
-			vel := weapon.GetAmmoVel()
-
-			acc := self.targetF.velocity.
-				Sub(self.targetI.velocity).
-				Mul(1.0 / (avi.SecondsPerTick * float64(self.targetF.tick-self.targetI.tick)))
-
-			if glog.V(4) {
-				glog.Infoln("Acc: ", acc)
-			}
-
-			deltaPos := targetPos.Sub(scan.Position)
-			deltaVel := targetVel.Sub(scan.Velocity)
-			time := calcT(deltaPos, deltaVel, vel)
-			if time < 0 {
+			dir, _, ok := self.targets.Aim(scan, tr, weapon.GetAmmoVel())
+			if !ok {
 				if glog.V(3) {
-					glog.Infoln("Target out of range", time)
+					glog.Infoln("Target out of range")
 				}
 				continue
 			}
 
-			dir := deltaVel.Add(deltaPos.Mul(1 / time)).Add(acc.Mul(time * 0.5))
-
 			if glog.V(3) {
 				glog.Infoln(dir, dir.Len())
 			}
@@ -171,7 +133,5 @@ func (self *MonsterPilot) fire(tick int64, scan avi.ScanResult) {
 			}
 			self.cooldownTicks = weapon.GetCoolDownTicks()
 		}
-		self.targetI.tick = tick
-		self.targetI.velocity = targetVel
 	}
 }
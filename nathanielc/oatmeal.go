@@ -1,6 +1,8 @@
 package nathanielc
 
 import (
+	"errors"
+
 	"github.com/go-gl/mathgl/mgl64"
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi"
@@ -19,6 +21,12 @@ type OatmealPilot struct {
 	maxForce    float64
 }
 
+// Params of the oatmeal pilot set by pilot_params.
+type oatmealParams struct {
+	// Speed to orbit the control point at
+	TargetVel float64 `yaml:"target_vel"`
+}
+
 func NewOatmeal() avi.Pilot {
 	if glog.V(4) {
 		glog.Infoln("New OATMEAL")
@@ -28,6 +36,18 @@ func NewOatmeal() avi.Pilot {
 	}
 }
 
+func (self *OatmealPilot) Configure(conf avi.ShipConf) error {
+	params := oatmealParams{TargetVel: self.targetVel}
+	if err := avi.DecodePilotParams(conf.PilotParams, &params); err != nil {
+		return err
+	}
+	if params.TargetVel <= 0 {
+		return errors.New("target_vel must be positive")
+	}
+	self.targetVel = params.TargetVel
+	return nil
+}
+
 func (self *OatmealPilot) Tick(tick int64) {
 	if self.navComputer == nil {
 		self.navComputer = nav.NewNav(self.Thrusters)
@@ -0,0 +1,64 @@
+package nav
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+)
+
+// Fraction of the maximum acceleration planned for braking,
+// the rest is left to correct for drift across the path.
+const brakingMargin = 0.8
+
+// A Controller decides the acceleration to apply each tick to reach a waypoint.
+type Controller interface {
+	// Acceleration returns the acceleration to apply this tick,
+	// its length must not exceed maxAcc.
+	Acceleration(pos, vel mgl64.Vec3, wp Waypoint, maxAcc float64) mgl64.Vec3
+}
+
+// BangBang accelerates at full power towards the waypoint and brakes as late as possible,
+// so that the ship arrives at the waypoint's ArriveSpeed without overshooting.
+type BangBang struct{}
+
+func (BangBang) Acceleration(pos, vel mgl64.Vec3, wp Waypoint, maxAcc float64) mgl64.Vec3 {
+	delta := wp.Position.Sub(pos)
+	distance := delta.Len()
+	var desiredVel mgl64.Vec3
+	if distance > 0 {
+		// Fastest speed from which we can still brake to the arrival speed
+		speed := math.Sqrt(wp.ArriveSpeed*wp.ArriveSpeed + 2*brakingMargin*maxAcc*distance)
+		if wp.MaxSpeed > 0 && speed > wp.MaxSpeed {
+			speed = wp.MaxSpeed
+		}
+		desiredVel = delta.Mul(speed / distance)
+	}
+	return clamp(desiredVel.Sub(vel).Mul(1/avi.SecondsPerTick), maxAcc)
+}
+
+// Limit the length of v to max.
+func clamp(v mgl64.Vec3, max float64) mgl64.Vec3 {
+	if l := v.Len(); l > max {
+		return v.Mul(max / l)
+	}
+	return v
+}
+
+// Maximum acceleration the thrusters can give a ship of the given mass,
+// limited to what the energy per tick can power. Use math.Inf(1) for unlimited energy.
+func MaxAcceleration(thrusters []*avi.Thruster, mass, energy float64) float64 {
+	force := 0.0
+	cost := 0.0
+	for _, t := range thrusters {
+		force += t.GetForce()
+		cost += t.GetEnergy()
+	}
+	if mass <= 0 {
+		return 0
+	}
+	if cost > energy {
+		force *= math.Max(energy, 0) / cost
+	}
+	return force / mass
+}
@@ -0,0 +1,102 @@
+package nav_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/nav"
+)
+
+// Fly a point mass to the waypoint with the controller, returning the
+// velocity on arrival and the fastest speed reached.
+func fly(t *testing.T, c nav.Controller, pos, vel mgl64.Vec3, wp nav.Waypoint, maxAcc float64) (mgl64.Vec3, float64) {
+	maxSpeed := 0.0
+	for tick := 0; tick < 120000; tick++ {
+		if wp.Position.Sub(pos).Len() < wp.Tolerance {
+			return vel, maxSpeed
+		}
+		acc := c.Acceleration(pos, vel, wp, maxAcc)
+		if acc.Len() > maxAcc*(1+1e-9) {
+			t.Fatalf("acceleration %f exceeds max %f", acc.Len(), maxAcc)
+		}
+		vel = vel.Add(acc.Mul(avi.SecondsPerTick))
+		pos = pos.Add(vel.Mul(avi.SecondsPerTick))
+		if s := vel.Len(); s > maxSpeed {
+			maxSpeed = s
+		}
+		if pos.X() > wp.Position.X()+wp.Tolerance {
+			t.Fatalf("overshot waypoint at %v", pos)
+		}
+	}
+	t.Fatalf("never reached waypoint, stopped at %v", pos)
+	return vel, maxSpeed
+}
+
+func TestBangBangArrivesAtRest(t *testing.T) {
+	wp := nav.Waypoint{
+		Position:  mgl64.Vec3{1000, 0, 0},
+		Tolerance: 1,
+	}
+	vel, _ := fly(t, nav.BangBang{}, mgl64.Vec3{}, mgl64.Vec3{}, wp, 10)
+	if s := vel.Len(); s > 5 {
+		t.Errorf("arrived too fast: %f", s)
+	}
+}
+
+func TestBangBangArriveSpeed(t *testing.T) {
+	wp := nav.Waypoint{
+		Position:    mgl64.Vec3{1000, 0, 0},
+		Tolerance:   1,
+		ArriveSpeed: 20,
+	}
+	vel, _ := fly(t, nav.BangBang{}, mgl64.Vec3{}, mgl64.Vec3{}, wp, 10)
+	if s := vel.Len(); math.Abs(s-20) > 1 {
+		t.Errorf("unexpected arrival speed: %f", s)
+	}
+}
+
+func TestBangBangMaxSpeed(t *testing.T) {
+	wp := nav.Waypoint{
+		Position:  mgl64.Vec3{1000, 0, 0},
+		Tolerance: 1,
+		MaxSpeed:  15,
+	}
+	_, maxSpeed := fly(t, nav.BangBang{}, mgl64.Vec3{}, mgl64.Vec3{}, wp, 10)
+	if maxSpeed > 15.01 {
+		t.Errorf("exceeded max speed: %f", maxSpeed)
+	}
+}
+
+func TestBangBangCorrectsDrift(t *testing.T) {
+	wp := nav.Waypoint{
+		Position:  mgl64.Vec3{500, 0, 0},
+		Tolerance: 1,
+	}
+	vel, _ := fly(t, nav.BangBang{}, mgl64.Vec3{}, mgl64.Vec3{0, 30, -10}, wp, 10)
+	if s := vel.Len(); s > 5 {
+		t.Errorf("arrived too fast: %f", s)
+	}
+}
+
+func TestMaxAcceleration(t *testing.T) {
+	thrusters := []*avi.Thruster{
+		avi.NewThrusterFromConf(mgl64.Vec3{}, avi.ThrusterConf{Force: 100, Energy: 10}),
+		avi.NewThrusterFromConf(mgl64.Vec3{}, avi.ThrusterConf{Force: 100, Energy: 10}),
+	}
+	testCases := []struct {
+		mass, energy, exp float64
+	}{
+		{mass: 10, energy: math.Inf(1), exp: 20},
+		{mass: 10, energy: 0, exp: 0},
+		{mass: 10, energy: 30, exp: 20},
+		{mass: 10, energy: 10, exp: 10},
+		{mass: 0, energy: 0, exp: 0},
+	}
+	for _, tc := range testCases {
+		if got := nav.MaxAcceleration(thrusters, tc.mass, tc.energy); got != tc.exp {
+			t.Errorf("unexpected max acceleration for mass %f energy %f: got %f exp %f", tc.mass, tc.energy, got, tc.exp)
+		}
+	}
+}
@@ -2,39 +2,88 @@ package nav
 
 import (
 	"errors"
+	"math"
 
 	"github.com/go-gl/mathgl/mgl64"
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi"
 )
 
+// Share of the ship's energy left unused so rounding never runs the thrusters out of energy.
+const energyRounding = 1e-9
+
 var NoMoreWaypoints = errors.New("No more waypoints")
+var NoThrust = errors.New("Thrusters have no force")
 
 type Waypoint struct {
 	Position  mgl64.Vec3
 	MaxSpeed  float64
 	Tolerance float64
+	// Speed to arrive at the waypoint with, only used by Steer.
+	ArriveSpeed float64
 }
 
 type Nav struct {
-	thrusters []*avi.Thruster
-	waypoints queue
-	set       bool
-	next      Waypoint
+	thrusters  []*avi.Thruster
+	waypoints  queue
+	set        bool
+	next       Waypoint
+	controller Controller
+	// Most energy per tick the thrusters may use, steering never uses more than the ship has left.
+	energy float64
+	// Known obstacles and the radius of the ship
+	obstacles []Obstacle
+	radius    float64
 }
 
 func NewNav(thrusters []*avi.Thruster) *Nav {
+	return NewNavWithController(thrusters, BangBang{})
+}
+
+// Create a Nav that uses the controller when steering.
+func NewNavWithController(thrusters []*avi.Thruster, c Controller) *Nav {
 	return &Nav{
-		thrusters: thrusters,
-		waypoints: queue{nodes: make([]Waypoint, 5)},
+		thrusters:  thrusters,
+		energy:     math.Inf(1),
+		waypoints:  queue{nodes: make([]Waypoint, 5)},
+		controller: c,
 	}
 }
 
+// Limit the energy per tick the thrusters may use when steering.
+// By default steering uses whatever energy the ship's engines have left.
+func (nav *Nav) SetEnergyBudget(energy float64) {
+	nav.energy = energy
+}
+
 func (nav *Nav) SetWaypoint(wp Waypoint) {
 	nav.set = true
 	nav.next = wp
 }
 
+// Set the known obstacles that Steer avoids and PlanRoute plans around,
+// radius is the radius of the ship.
+func (nav *Nav) SetObstacles(obstacles []Obstacle, radius float64) {
+	nav.obstacles = obstacles
+	nav.radius = radius
+}
+
+// Replace the waypoints with a route from pos to wp around the known obstacles.
+// Every waypoint on the route uses the speeds and tolerance of wp.
+func (nav *Nav) PlanRoute(pos mgl64.Vec3, wp Waypoint) error {
+	path, err := Plan(pos, wp.Position, nav.obstacles, nav.radius)
+	if err != nil {
+		return err
+	}
+	nav.ClearWaypoints()
+	for _, p := range path {
+		next := wp
+		next.Position = p
+		nav.AddWaypoint(next)
+	}
+	return nil
+}
+
 func (nav *Nav) ClearWaypoints() {
 	nav.set = false
 	nav.waypoints.Clear()
@@ -45,11 +94,51 @@ func (nav *Nav) AddWaypoint(wp Waypoint) {
 }
 
 func (nav *Nav) Tick(pos, vel mgl64.Vec3) error {
+	reached, err := nav.advance(pos)
+	if err != nil || reached {
+		return err
+	}
+
+	n := nav.next.Position.Sub(pos).Normalize()
+	desiredVel := n.Mul(nav.next.MaxSpeed)
+
+	accerlation := desiredVel.Sub(vel)
+
+	return nav.thrust(accerlation)
+}
+
+// Steer towards the next waypoint using the controller, never asking
+// the thrusters for more than they can give a ship of the given mass.
+func (nav *Nav) Steer(pos, vel mgl64.Vec3, mass float64) error {
+	reached, err := nav.advance(pos)
+	if err != nil || reached {
+		return err
+	}
+	maxAcc := MaxAcceleration(nav.thrusters, mass, nav.availableEnergy())
+	acc := nav.controller.Acceleration(pos, vel, nav.next, maxAcc)
+	if len(nav.obstacles) > 0 && maxAcc > 0 {
+		// Look ahead at least as far as it takes to stop
+		horizon := vel.Len()/maxAcc + 1
+		acc = Avoid(pos, vel, acc, nav.obstacles, nav.radius, horizon, maxAcc)
+	}
+	return nav.thrustShared(acc)
+}
+
+// Energy the thrusters may use this tick, the budget capped by what the engines have left.
+func (nav *Nav) availableEnergy() float64 {
+	if len(nav.thrusters) == 0 {
+		return 0
+	}
+	return math.Min(nav.energy, nav.thrusters[0].GetAvailableEnergy()*(1-energyRounding))
+}
+
+// Move on to the next waypoint if needed, reports whether the current waypoint was just reached.
+func (nav *Nav) advance(pos mgl64.Vec3) (bool, error) {
 	if !nav.set {
 		var ok bool
 		nav.next, ok = nav.waypoints.Pop()
 		if !ok {
-			return NoMoreWaypoints
+			return false, NoMoreWaypoints
 		}
 		nav.set = true
 	}
@@ -58,9 +147,7 @@ func (nav *Nav) Tick(pos, vel mgl64.Vec3) error {
 		glog.Infoln("Next", nav.next)
 	}
 
-	delta := nav.next.Position.Sub(pos)
-	distance := delta.Len()
-
+	distance := nav.next.Position.Sub(pos).Len()
 	t := nav.next.Tolerance
 
 	if distance < t {
@@ -68,15 +155,9 @@ func (nav *Nav) Tick(pos, vel mgl64.Vec3) error {
 			glog.Infoln("Hit waypoint", nav.next, distance, t)
 		}
 		nav.set = false
-		return nil
+		return true, nil
 	}
-
-	n := delta.Normalize()
-	desiredVel := n.Mul(nav.next.MaxSpeed)
-
-	accerlation := desiredVel.Sub(vel)
-
-	return nav.thrust(accerlation)
+	return false, nil
 }
 
 func (nav *Nav) thrust(acc mgl64.Vec3) error {
@@ -92,3 +173,25 @@ func (nav *Nav) thrust(acc mgl64.Vec3) error {
 	}
 	return nil
 }
+
+// Thrust with each thruster in proportion to its force, so no thruster
+// is asked for more than its share.
+func (nav *Nav) thrustShared(acc mgl64.Vec3) error {
+	total := 0.0
+	for _, thruster := range nav.thrusters {
+		total += thruster.GetForce()
+	}
+	if total <= 0 {
+		return NoThrust
+	}
+	if acc.Len() == 0 {
+		return nil
+	}
+	for _, thruster := range nav.thrusters {
+		err := thruster.Thrust(acc.Mul(thruster.GetForce() / total))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package nav_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/avitest"
+	"github.com/nathanielc/avi/nav"
+)
+
+const navShip = `
+position: [0, 0, 0]
+hull_strength: 1
+parts:
+  - {name: nuclear, type: engine, position: [0, 0, 0]}
+  - {name: rocket, type: thruster, position: [20, 0, 0]}
+  - {name: rocket, type: thruster, position: [-20, 0, 0]}
+`
+
+func TestSteerFliesShip(t *testing.T) {
+	s := avitest.New(t, ``)
+	var id avi.ID
+	var n *nav.Nav
+	var steerErr error
+	arrived := false
+	id = s.AddScripted("navs", navShip, func(tick int64, p *avi.GenericPilot) {
+		if n == nil {
+			n = nav.NewNav(p.Thrusters)
+			n.AddWaypoint(nav.Waypoint{Position: mgl64.Vec3{500, 0, 0}, Tolerance: 5})
+		}
+		for _, e := range p.Engines {
+			e.PowerOn(1)
+		}
+		// Engines produce energy from the tick after they are powered on
+		if tick == 0 {
+			return
+		}
+		ship, _ := s.Ship(id)
+		err := n.Steer(ship.Position, ship.Velocity, ship.Mass)
+		switch err {
+		case nil:
+		case nav.NoMoreWaypoints:
+			arrived = true
+		default:
+			steerErr = err
+		}
+	})
+	s.AssertWithin(time.Minute, func(*avitest.Sim) bool { return arrived || steerErr != nil }, "arrived")
+	if steerErr != nil {
+		t.Fatal(steerErr)
+	}
+	ship, _ := s.Ship(id)
+	if d := ship.Position.Sub(mgl64.Vec3{500, 0, 0}).Len(); d > 10 {
+		t.Errorf("stopped %fm from the waypoint at %v", d, ship.Position)
+	}
+	if v := ship.Velocity.Len(); v > 5 {
+		t.Errorf("arrived too fast %f", v)
+	}
+}
+
+func TestSteerWithoutForce(t *testing.T) {
+	thrusters := []*avi.Thruster{avi.NewThrusterFromConf(mgl64.Vec3{}, avi.ThrusterConf{})}
+	n := nav.NewNav(thrusters)
+	n.AddWaypoint(nav.Waypoint{Position: mgl64.Vec3{100, 0, 0}, Tolerance: 1})
+	if err := n.Steer(mgl64.Vec3{}, mgl64.Vec3{}, 1); err != nav.NoThrust {
+		t.Errorf("expected NoThrust got %v", err)
+	}
+}
+
+func TestSteerWithinEngineEnergy(t *testing.T) {
+	s := avitest.New(t, ``)
+	var id avi.ID
+	var n *nav.Nav
+	var steerErr error
+	id = s.AddScripted("navs", navShip, func(tick int64, p *avi.GenericPilot) {
+		if n == nil {
+			n = nav.NewNav(p.Thrusters)
+			n.AddWaypoint(nav.Waypoint{Position: mgl64.Vec3{500, 0, 0}, Tolerance: 5})
+		}
+		// A third of the energy the thrusters need at full force
+		for _, e := range p.Engines {
+			e.PowerOn(0.005)
+		}
+		if tick == 0 {
+			return
+		}
+		ship, _ := s.Ship(id)
+		if err := n.Steer(ship.Position, ship.Velocity, ship.Mass); err != nil && steerErr == nil {
+			steerErr = err
+		}
+	})
+	s.Run(time.Second)
+	if steerErr != nil {
+		t.Fatal(steerErr)
+	}
+	ship, _ := s.Ship(id)
+	if v := ship.Velocity.X(); v <= 0 {
+		t.Errorf("unexpected velocity %v", ship.Velocity)
+	}
+}
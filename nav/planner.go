@@ -0,0 +1,287 @@
+package nav
+
+import (
+	"errors"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+)
+
+var NoPath = errors.New("No path to goal")
+
+// Obstacles are expanded by this factor when placing the waypoints that lead around them,
+// so that neighbouring waypoints can see each other past the obstacle.
+const detourFactor = 1.4
+
+// A spherical obstacle to steer around.
+type Obstacle struct {
+	Position mgl64.Vec3
+	Velocity mgl64.Vec3
+	Radius   float64
+}
+
+// Directions of the detour waypoints placed around each obstacle,
+// the vertices of an octahedron and a cube.
+var detourDirs = func() []mgl64.Vec3 {
+	dirs := []mgl64.Vec3{
+		{1, 0, 0}, {-1, 0, 0},
+		{0, 1, 0}, {0, -1, 0},
+		{0, 0, 1}, {0, 0, -1},
+	}
+	for _, x := range []float64{-1, 1} {
+		for _, y := range []float64{-1, 1} {
+			for _, z := range []float64{-1, 1} {
+				dirs = append(dirs, mgl64.Vec3{x, y, z}.Normalize())
+			}
+		}
+	}
+	return dirs
+}()
+
+// Obstacles in the scan that ships should steer around.
+func ScanObstacles(scan avi.ScanResult) []Obstacle {
+	obstacles := make([]Obstacle, len(scan.Asteroids))
+	for i, a := range scan.Asteroids {
+		obstacles[i] = Obstacle{
+			Position: a.Position,
+			Velocity: a.Velocity,
+			Radius:   a.Radius,
+		}
+	}
+	return obstacles
+}
+
+// Plan finds a short path from start to goal that stays at least clearance away from every obstacle.
+// It searches a visibility graph of detour points placed around the obstacles
+// and returns the positions to visit in order, ending with the goal.
+// A start within the clearance of an obstacle first leads straight out of it.
+func Plan(start, goal mgl64.Vec3, obstacles []Obstacle, clearance float64) ([]mgl64.Vec3, error) {
+	for _, o := range obstacles {
+		if inside(goal, o, clearance) {
+			return nil, NoPath
+		}
+	}
+	for _, o := range obstacles {
+		if inside(start, o, clearance) {
+			exit, ok := escape(start, o, obstacles, clearance)
+			if !ok {
+				return nil, NoPath
+			}
+			path, err := Plan(exit, goal, obstacles, clearance)
+			if err != nil {
+				return nil, err
+			}
+			return append([]mgl64.Vec3{exit}, path...), nil
+		}
+	}
+	if visible(start, goal, obstacles, clearance) {
+		return []mgl64.Vec3{goal}, nil
+	}
+
+	// Nodes 0 and 1 are the start and goal
+	nodes := []mgl64.Vec3{start, goal}
+	for _, o := range obstacles {
+		r := (o.Radius + clearance) * detourFactor
+		for _, d := range detourDirs {
+			p := o.Position.Add(d.Mul(r))
+			free := true
+			for _, other := range obstacles {
+				if inside(p, other, clearance) {
+					free = false
+					break
+				}
+			}
+			if free {
+				nodes = append(nodes, p)
+			}
+		}
+	}
+
+	// Dijkstra's algorithm over the visibility graph, edges are checked lazily
+	n := len(nodes)
+	dist := make([]float64, n)
+	prev := make([]int, n)
+	done := make([]bool, n)
+	for i := range dist {
+		dist[i] = math.Inf(1)
+		prev[i] = -1
+	}
+	dist[0] = 0
+	for {
+		u := -1
+		for i := range nodes {
+			if !done[i] && !math.IsInf(dist[i], 1) && (u == -1 || dist[i] < dist[u]) {
+				u = i
+			}
+		}
+		if u == -1 {
+			return nil, NoPath
+		}
+		if u == 1 {
+			break
+		}
+		done[u] = true
+		for v := range nodes {
+			if done[v] {
+				continue
+			}
+			d := dist[u] + nodes[v].Sub(nodes[u]).Len()
+			if d < dist[v] && visible(nodes[u], nodes[v], obstacles, clearance) {
+				dist[v] = d
+				prev[v] = u
+			}
+		}
+	}
+
+	var path []mgl64.Vec3
+	for i := 1; i != 0; i = prev[i] {
+		path = append(path, nodes[i])
+	}
+	// Reverse into travel order
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// Find the closest detour point of the obstacle that is clear of all obstacles.
+func escape(start mgl64.Vec3, o Obstacle, obstacles []Obstacle, clearance float64) (mgl64.Vec3, bool) {
+	r := (o.Radius + clearance) * detourFactor
+	dirs := detourDirs
+	if out := start.Sub(o.Position); avi.LengthSq(out) > 0 {
+		// Prefer leaving the way the ship is already facing out
+		dirs = append([]mgl64.Vec3{out.Normalize()}, detourDirs...)
+	}
+	best, found := mgl64.Vec3{}, false
+	for _, d := range dirs {
+		p := o.Position.Add(d.Mul(r))
+		free := true
+		for _, other := range obstacles {
+			if inside(p, other, clearance) {
+				free = false
+				break
+			}
+		}
+		if free && (!found || avi.LengthSq(p.Sub(start)) < avi.LengthSq(best.Sub(start))) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+func inside(p mgl64.Vec3, o Obstacle, clearance float64) bool {
+	r := o.Radius + clearance
+	return avi.LengthSq(p.Sub(o.Position)) < r*r
+}
+
+// Whether the segment from a to b stays clear of all obstacles.
+func visible(a, b mgl64.Vec3, obstacles []Obstacle, clearance float64) bool {
+	ab := b.Sub(a)
+	l2 := avi.LengthSq(ab)
+	for _, o := range obstacles {
+		t := 0.0
+		if l2 > 0 {
+			t = math.Max(0, math.Min(1, o.Position.Sub(a).Dot(ab)/l2))
+		}
+		if inside(a.Add(ab.Mul(t)), o, clearance) {
+			return false
+		}
+	}
+	return true
+}
+
+// Avoid deflects the acceleration away from the first obstacle the ship is predicted to hit
+// within horizon seconds, given the ship's radius and maximum acceleration.
+func Avoid(pos, vel, acc mgl64.Vec3, obstacles []Obstacle, radius, horizon, maxAcc float64) mgl64.Vec3 {
+	first := math.Inf(1)
+	var away mgl64.Vec3
+	for _, o := range obstacles {
+		d := o.Position.Sub(pos)
+		v := vel.Sub(o.Velocity)
+		v2 := avi.LengthSq(v)
+		if v2 == 0 {
+			continue
+		}
+		// Time and distance of closest approach
+		tca := d.Dot(v) / v2
+		if tca <= 0 || tca > horizon || tca >= first {
+			continue
+		}
+		miss := v.Mul(tca).Sub(d)
+		r := o.Radius + radius
+		if avi.LengthSq(miss) >= r*r {
+			continue
+		}
+		first = tca
+		if avi.LengthSq(miss) == 0 {
+			// Head on, pick any direction across our path
+			miss = v.Cross(mgl64.Vec3{0, 0, 1})
+			if avi.LengthSq(miss) == 0 {
+				miss = v.Cross(mgl64.Vec3{0, 1, 0})
+			}
+		}
+		away = miss.Normalize()
+	}
+	if math.IsInf(first, 1) {
+		return acc
+	}
+	return clamp(acc.Add(away.Mul(maxAcc)), maxAcc)
+}
+
+// Router keeps a path around obstacles to a goal, planning a new path
+// only once the goal or the obstacles have moved.
+type Router struct {
+	// Number of paths planned
+	Plans int
+
+	planned   bool
+	goal      mgl64.Vec3
+	obstacles []Obstacle
+	clearance float64
+	path      []mgl64.Vec3
+}
+
+// Next returns the position to fly to from pos on the way to the goal,
+// or false when the way is clear or no path exists and the ship should fly straight to the goal.
+// Positions within clearance of pos are considered reached.
+func (r *Router) Next(pos, goal mgl64.Vec3, obstacles []Obstacle, clearance float64) (mgl64.Vec3, bool) {
+	if len(obstacles) == 0 {
+		r.planned = false
+		r.path = nil
+		return goal, false
+	}
+	if !r.planned || r.moved(goal, obstacles, clearance) {
+		r.Plans++
+		r.planned = true
+		r.goal = goal
+		r.obstacles = append(r.obstacles[0:0], obstacles...)
+		r.clearance = clearance
+		r.path, _ = Plan(pos, goal, obstacles, clearance)
+	}
+	for len(r.path) > 1 && r.path[0].Sub(pos).Len() < clearance {
+		r.path = r.path[1:]
+	}
+	if len(r.path) < 2 {
+		return goal, false
+	}
+	return r.path[0], true
+}
+
+// Reports whether the goal or obstacles moved more than the clearance since the path was planned.
+func (r *Router) moved(goal mgl64.Vec3, obstacles []Obstacle, clearance float64) bool {
+	if clearance != r.clearance || len(obstacles) != len(r.obstacles) {
+		return true
+	}
+	c2 := clearance * clearance
+	if avi.LengthSq(goal.Sub(r.goal)) > c2 {
+		return true
+	}
+	for i, o := range obstacles {
+		p := r.obstacles[i]
+		if o.Radius != p.Radius || avi.LengthSq(o.Position.Sub(p.Position)) > c2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package nav_test
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/nav"
+)
+
+// Distance from p to the closest point on the segment a b.
+func segmentDistance(a, b, p mgl64.Vec3) float64 {
+	ab := b.Sub(a)
+	t := p.Sub(a).Dot(ab) / avi.LengthSq(ab)
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+	return p.Sub(a.Add(ab.Mul(t))).Len()
+}
+
+func TestPlanDirect(t *testing.T) {
+	goal := mgl64.Vec3{100, 0, 0}
+	obstacles := []nav.Obstacle{{Position: mgl64.Vec3{50, 50, 0}, Radius: 10}}
+	path, err := nav.Plan(mgl64.Vec3{}, goal, obstacles, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 1 || path[0] != goal {
+		t.Errorf("expected direct path, got %v", path)
+	}
+}
+
+func TestPlanAroundObstacles(t *testing.T) {
+	start := mgl64.Vec3{}
+	goal := mgl64.Vec3{1000, 0, 0}
+	clearance := 5.0
+	obstacles := []nav.Obstacle{
+		{Position: mgl64.Vec3{300, 0, 0}, Radius: 50},
+		{Position: mgl64.Vec3{600, 20, 0}, Radius: 80},
+	}
+	path, err := nav.Plan(start, goal, obstacles, clearance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) < 2 || path[len(path)-1] != goal {
+		t.Fatalf("expected detour ending at the goal, got %v", path)
+	}
+	prev := start
+	for _, p := range path {
+		for _, o := range obstacles {
+			if d := segmentDistance(prev, p, o.Position); d < o.Radius+clearance {
+				t.Errorf("segment %v to %v passes within %f of obstacle %v", prev, p, d, o)
+			}
+		}
+		prev = p
+	}
+}
+
+func TestPlanGoalInsideObstacle(t *testing.T) {
+	obstacles := []nav.Obstacle{{Position: mgl64.Vec3{100, 0, 0}, Radius: 10}}
+	if _, err := nav.Plan(mgl64.Vec3{}, mgl64.Vec3{100, 5, 0}, obstacles, 1); err != nav.NoPath {
+		t.Errorf("expected NoPath, got %v", err)
+	}
+}
+
+func TestPlanStartInsideClearance(t *testing.T) {
+	start := mgl64.Vec3{-3, 0, 0}
+	goal := mgl64.Vec3{100, 0, 0}
+	clearance := 5.0
+	o := nav.Obstacle{Position: mgl64.Vec3{10, 0, 0}, Radius: 10}
+	path, err := nav.Plan(start, goal, []nav.Obstacle{o}, clearance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) < 2 || path[len(path)-1] != goal {
+		t.Fatalf("expected a way out ending at the goal, got %v", path)
+	}
+	if d := path[0].Sub(o.Position).Len(); d < o.Radius+clearance {
+		t.Errorf("exit %v is within %f of the obstacle", path[0], d)
+	}
+	for i := 1; i < len(path); i++ {
+		if d := segmentDistance(path[i-1], path[i], o.Position); d < o.Radius+clearance {
+			t.Errorf("segment %v to %v passes within %f of the obstacle", path[i-1], path[i], d)
+		}
+	}
+}
+
+func TestScanObstacles(t *testing.T) {
+	scan := avi.ScanResult{Asteroids: []avi.AsteroidSR{{Position: mgl64.Vec3{1, 2, 3}, Radius: 4}}}
+	obstacles := nav.ScanObstacles(scan)
+	if len(obstacles) != 1 || obstacles[0].Position != (mgl64.Vec3{1, 2, 3}) || obstacles[0].Radius != 4 {
+		t.Errorf("unexpected obstacles %v", obstacles)
+	}
+}
+
+func TestAvoid(t *testing.T) {
+	obstacles := []nav.Obstacle{{Position: mgl64.Vec3{100, 0, 0}, Radius: 10}}
+	acc := mgl64.Vec3{1, 0, 0}
+
+	// Not moving towards the obstacle
+	got := nav.Avoid(mgl64.Vec3{}, mgl64.Vec3{0, 10, 0}, acc, obstacles, 1, 10, 10)
+	if got != acc {
+		t.Errorf("unexpected deflection %v", got)
+	}
+
+	// Collision predicted, deflect across the path
+	got = nav.Avoid(mgl64.Vec3{}, mgl64.Vec3{10, 1, 0}, acc, obstacles, 1, 20, 10)
+	if got.Y() <= 0 {
+		t.Errorf("expected deflection away from the obstacle, got %v", got)
+	}
+	if got.Len() > 10+1e-9 {
+		t.Errorf("deflection %v exceeds max acceleration", got)
+	}
+
+	// Collision beyond the horizon is ignored
+	got = nav.Avoid(mgl64.Vec3{}, mgl64.Vec3{10, 1, 0}, acc, obstacles, 1, 5, 10)
+	if got != acc {
+		t.Errorf("unexpected deflection %v", got)
+	}
+}
+
+func TestPlanRouteAfterClear(t *testing.T) {
+	n := nav.NewNav(nil)
+	n.AddWaypoint(nav.Waypoint{Position: mgl64.Vec3{1, 0, 0}})
+	n.SetObstacles([]nav.Obstacle{{Position: mgl64.Vec3{50, 0, 0}, Radius: 10}}, 1)
+	for i := 0; i < 2; i++ {
+		if err := n.PlanRoute(mgl64.Vec3{}, nav.Waypoint{Position: mgl64.Vec3{100, 0, 0}, Tolerance: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRouterReplansOnlyWhenMoved(t *testing.T) {
+	var r nav.Router
+	start := mgl64.Vec3{-200, 0, 0}
+	goal := mgl64.Vec3{200, 0, 0}
+	obstacles := []nav.Obstacle{{Position: mgl64.Vec3{}, Radius: 50}}
+
+	leg, ok := r.Next(start, goal, obstacles, 10)
+	if !ok {
+		t.Fatal("expected a detour around the obstacle")
+	}
+	if _, ok := r.Next(start, goal, obstacles, 10); !ok || r.Plans != 1 {
+		t.Errorf("unexpected replan, %d plans", r.Plans)
+	}
+
+	// Reaching a leg moves on along the same path
+	next, _ := r.Next(leg, goal, obstacles, 10)
+	if next == leg || r.Plans != 1 {
+		t.Errorf("expected the next leg of the same path, got %v after %d plans", next, r.Plans)
+	}
+
+	r.Next(leg, mgl64.Vec3{200, 100, 0}, obstacles, 10)
+	if r.Plans != 2 {
+		t.Errorf("expected a replan for the new goal, %d plans", r.Plans)
+	}
+	moved := []nav.Obstacle{{Position: mgl64.Vec3{0, 20, 0}, Radius: 50}}
+	r.Next(leg, mgl64.Vec3{200, 100, 0}, moved, 10)
+	if r.Plans != 3 {
+		t.Errorf("expected a replan for the moved obstacle, %d plans", r.Plans)
+	}
+
+	if got, ok := r.Next(start, goal, nil, 10); ok || got != goal {
+		t.Errorf("expected a clear way to the goal, got %v", got)
+	}
+}
@@ -35,7 +35,6 @@ func (q *queue) Pop() (Waypoint, bool) {
 }
 
 func (q *queue) Clear() {
-	q.nodes = q.nodes[0:0]
 	q.head = 0
 	q.tail = 0
 	q.count = 0
@@ -0,0 +1,44 @@
+package avi
+
+import (
+	"github.com/golang/glog"
+)
+
+// Fleet and team of neutral NPC ships, which no fleet may use.
+const NeutralFleet = "neutral"
+
+// Adds a neutral ship using a registered pilot, positioned relative to the map origin.
+// Neutral ships obey the same physics as any other ship but are not counted as
+// survivors, cannot score or capture, and do not award points when destroyed.
+func (sim *Simulation) addNPC(conf ShipConf) error {
+	pilot, err := newPilot(conf, NeutralFleet, NeutralFleet)
+	if err != nil {
+		return err
+	}
+	pos, err := sliceToVec(conf.Position)
+	if err != nil {
+		return err
+	}
+	ship, err := newShip(sim.getNextID(), sim, NeutralFleet, pos, pilot, conf)
+	if err != nil {
+		return err
+	}
+	ship.team = NeutralFleet
+	ship.npc = true
+	ship.vip = false
+	ship.spawned = sim.tick
+	sim.ships = append(sim.ships, ship)
+	sim.added[ship.id] = ship
+	glog.Infof("Added neutral ship with pilot %s", conf.Pilot)
+	return nil
+}
+
+// Reports whether any neutral ships are still alive.
+func (sim *Simulation) npcsRemain() bool {
+	for _, ship := range sim.ships {
+		if ship.npc {
+			return true
+		}
+	}
+	return false
+}
@@ -40,4 +40,14 @@ type PartSetConf struct {
 	Thrusters map[string]ThrusterConf `yaml:"thrusters" json:"thrusters"`
 	Weapons   map[string]WeaponConf   `yaml:"weapons" json:"weapons"`
 	Sensors   map[string]SensorConf   `yaml:"sensors" json:"sensors"`
+	Comms     map[string]CommsConf    `yaml:"comms" json:"comms"`
+}
+
+func (c PartSetConf) Validate() error {
+	for name, w := range c.Weapons {
+		if err := w.Validate(); err != nil {
+			return errors.New(fmt.Sprintf("invalid weapon '%s': %s", name, err))
+		}
+	}
+	return nil
 }
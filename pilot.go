@@ -1,11 +1,35 @@
 package avi
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
 type Pilot interface {
 	JoinFleet(fleet string)
 	LinkParts([]ShipPartConf, PartSetConf) ([]Part, error)
 	Tick(int64)
 }
 
+// Pilots that implement teamPilot are told the team of their fleet.
+type teamPilot interface {
+	JoinTeam(team string)
+}
+
+// Pilots that implement Configurable are configured from their ship's conf
+// before their parts are linked, an error rejects the ship.
+type Configurable interface {
+	Configure(conf ShipConf) error
+}
+
+// Pilots that implement Closer are closed once they will not fly again,
+// either their ship was destroyed for good or the game ended.
+type Closer interface {
+	Close()
+}
+
 type pilotFactory func() Pilot
 
 var registeredPilots = make(map[string]pilotFactory)
@@ -23,6 +47,40 @@ func getPilot(pilot string) Pilot {
 	return nil
 }
 
+// Create the pilot for a ship and tell it its fleet, team and conf.
+func newPilot(conf ShipConf, fleet, team string) (Pilot, error) {
+	pilot := getPilot(conf.Pilot)
+	if pilot == nil {
+		return nil, errors.New(fmt.Sprintf("Unknown pilot '%s'", conf.Pilot))
+	}
+	pilot.JoinFleet(fleet)
+	if tp, ok := pilot.(teamPilot); ok {
+		tp.JoinTeam(team)
+	}
+	if c, ok := pilot.(Configurable); ok {
+		if err := c.Configure(conf); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid configuration for pilot '%s': %s", conf.Pilot, err.Error()))
+		}
+	} else if len(conf.PilotParams) > 0 {
+		return nil, errors.New(fmt.Sprintf("Pilot '%s' does not accept pilot_params", conf.Pilot))
+	}
+	return pilot, nil
+}
+
+// Decode pilot params into the struct pointed to by out, matching keys to the fields' yaml tags.
+// Fields missing from the params keep their values, unknown keys and mismatched types are errors.
+func DecodePilotParams(params map[string]interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: true,
+		TagName:     "yaml",
+		Result:      out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(params)
+}
+
 func init() {
 	RegisterPilot("dud", NewDud)
 }
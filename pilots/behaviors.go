@@ -0,0 +1,249 @@
+package pilots
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/nav"
+)
+
+func init() {
+	RegisterBehavior("hold_control_point", newHoldControlPoint)
+	RegisterBehavior("hunt", newHunt)
+	RegisterBehavior("kite", newKite)
+	RegisterBehavior("evade", newEvade)
+	RegisterBehavior("resupply", newResupply)
+}
+
+// Flies to the active control point worth the most points and stays within its influence.
+type holdControlPoint struct {
+	// Fraction of the influence radius to stay within
+	tolerance float64
+	maxSpeed  float64
+}
+
+func newHoldControlPoint(params Params) (Behavior, error) {
+	if err := params.check("tolerance", "max_speed"); err != nil {
+		return nil, err
+	}
+	return &holdControlPoint{
+		tolerance: params.get("tolerance", 0.5),
+		maxSpeed:  params.get("max_speed", 0),
+	}, nil
+}
+
+func (b *holdControlPoint) Steer(s *State) (nav.Waypoint, bool) {
+	best := avi.ID(avi.NilID)
+	points := 0.0
+	for id, cp := range s.Scan.ControlPoints {
+		if !cp.Active {
+			continue
+		}
+		// Ties go to the lowest ID so the choice is stable between ticks
+		if best == avi.NilID || cp.Points > points || cp.Points == points && id < best {
+			best = id
+			points = cp.Points
+		}
+	}
+	if best == avi.NilID {
+		return nav.Waypoint{}, false
+	}
+	cp := s.Scan.ControlPoints[best]
+	return nav.Waypoint{
+		Position:  cp.Position,
+		Tolerance: cp.Influence * b.tolerance,
+		MaxSpeed:  b.maxSpeed,
+	}, true
+}
+
+// Chases the nearest enemy and fires at it.
+type hunt struct {
+	// Distance to close to before firing from a standstill
+	rng float64
+}
+
+func newHunt(params Params) (Behavior, error) {
+	if err := params.check("range"); err != nil {
+		return nil, err
+	}
+	return &hunt{
+		rng: params.get("range", 300),
+	}, nil
+}
+
+func (b *hunt) Steer(s *State) (nav.Waypoint, bool) {
+	t, ok := s.Pilot.Targets.Target(s.Scan)
+	if !ok {
+		return nav.Waypoint{}, false
+	}
+	return nav.Waypoint{
+		Position:  t.Position(),
+		Tolerance: b.rng,
+	}, true
+}
+
+func (b *hunt) Shoot(s *State) {
+	if t, ok := s.Pilot.Targets.Target(s.Scan); ok {
+		s.Pilot.FireAt(s, t)
+	}
+}
+
+// Keeps the nearest enemy at a fixed distance while firing at it.
+type kite struct {
+	rng float64
+}
+
+func newKite(params Params) (Behavior, error) {
+	if err := params.check("range"); err != nil {
+		return nil, err
+	}
+	return &kite{
+		rng: params.get("range", 500),
+	}, nil
+}
+
+func (b *kite) Steer(s *State) (nav.Waypoint, bool) {
+	t, ok := s.Pilot.Targets.Target(s.Scan)
+	if !ok {
+		return nav.Waypoint{}, false
+	}
+	away := s.Scan.Position.Sub(t.Position())
+	if avi.LengthSq(away) == 0 {
+		away = mgl64.Vec3{1, 0, 0}
+	}
+	return nav.Waypoint{
+		Position:    t.Position().Add(away.Normalize().Mul(b.rng)),
+		Tolerance:   b.rng * 0.1,
+		ArriveSpeed: t.Velocity().Len(),
+	}, true
+}
+
+func (b *kite) Shoot(s *State) {
+	if t, ok := s.Pilot.Targets.Target(s.Scan); ok {
+		s.Pilot.FireAt(s, t)
+	}
+}
+
+// Dodges enemy projectiles predicted to hit the ship.
+type evade struct {
+	// Extra distance to keep from projectiles
+	margin float64
+	// Seconds ahead to look for hits
+	horizon float64
+}
+
+func newEvade(params Params) (Behavior, error) {
+	if err := params.check("margin", "horizon"); err != nil {
+		return nil, err
+	}
+	return &evade{
+		margin:  params.get("margin", 10),
+		horizon: params.get("horizon", 2),
+	}, nil
+}
+
+func (b *evade) Steer(s *State) (nav.Waypoint, bool) {
+	first := math.Inf(1)
+	var dodge mgl64.Vec3
+	for _, p := range s.Scan.Projectiles {
+		if p.Team == s.Pilot.Team {
+			continue
+		}
+		d := p.Position.Sub(s.Scan.Position)
+		v := p.Velocity.Sub(s.Scan.Velocity)
+		v2 := avi.LengthSq(v)
+		if v2 == 0 {
+			continue
+		}
+		// Time and offset of closest approach
+		tca := -d.Dot(v) / v2
+		if tca <= 0 || tca > b.horizon || tca >= first {
+			continue
+		}
+		miss := d.Add(v.Mul(tca))
+		r := s.Scan.Radius + p.Radius + b.margin
+		if avi.LengthSq(miss) >= r*r {
+			continue
+		}
+		first = tca
+		// Move away from where the projectile will pass
+		dodge = miss.Mul(-1)
+		if avi.LengthSq(dodge) == 0 {
+			dodge = v.Cross(mgl64.Vec3{0, 0, 1})
+			if avi.LengthSq(dodge) == 0 {
+				dodge = v.Cross(mgl64.Vec3{0, 1, 0})
+			}
+		}
+		dodge = dodge.Normalize().Mul(2 * r)
+	}
+	if math.IsInf(first, 1) {
+		return nav.Waypoint{}, false
+	}
+	return nav.Waypoint{
+		Position: s.Scan.Position.Add(dodge),
+	}, true
+}
+
+// Returns to a repair or resupply zone when damaged or low on ammunition,
+// and stays until fully restored. Without a suitable zone the ship keeps fighting.
+type resupply struct {
+	// Fractions of full health and ammunition that trigger a return
+	health float64
+	ammo   float64
+
+	returning bool
+}
+
+func newResupply(params Params) (Behavior, error) {
+	if err := params.check("health", "ammo"); err != nil {
+		return nil, err
+	}
+	return &resupply{
+		health: params.get("health", 0.5),
+		ammo:   params.get("ammo", 0.2),
+	}, nil
+}
+
+func (b *resupply) Steer(s *State) (nav.Waypoint, bool) {
+	p := s.Pilot
+	damaged := s.Scan.Health < p.MaxHealth
+	lowAmmo := false
+	emptyAmmo := false
+	for _, w := range p.Weapons {
+		c := w.GetAmmoCapacity()
+		if w.GetAmmo() < c {
+			lowAmmo = true
+		}
+		if float64(w.GetAmmo()) < b.ammo*float64(c) {
+			emptyAmmo = true
+		}
+	}
+	if !b.returning {
+		b.returning = s.Scan.Health < b.health*p.MaxHealth || emptyAmmo
+	}
+	if b.returning && !damaged && !lowAmmo {
+		b.returning = false
+	}
+	if !b.returning {
+		return nav.Waypoint{}, false
+	}
+
+	var wp nav.Waypoint
+	closest := math.Inf(1)
+	for _, z := range s.Scan.Zones {
+		if !(damaged && z.Repair > 0 || lowAmmo && z.Resupply > 0) || z.Damage > 0 {
+			continue
+		}
+		if d := avi.LengthSq(z.Position.Sub(s.Scan.Position)); d < closest {
+			closest = d
+			wp.Position = z.Position
+			// Stay well inside the zone
+			wp.Tolerance = z.Radius / 2
+			if z.Shape == avi.ZoneBox {
+				wp.Tolerance = math.Min(z.Size.X(), math.Min(z.Size.Y(), z.Size.Z())) / 4
+			}
+		}
+	}
+	return wp, !math.IsInf(closest, 1)
+}
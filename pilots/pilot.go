@@ -0,0 +1,286 @@
+// Package pilots provides a pilot assembled from configurable behaviours,
+// so competent fleets can be fielded without writing any Go.
+//
+// A ship using the pilot lists its behaviours in priority order:
+//
+//	pilot: behavior
+//	pilot_params:
+//	  behaviors:
+//	    - name: evade
+//	    - name: resupply
+//	      params: {health: 0.3}
+//	    - name: hunt
+//	      params: {range: 400}
+//	    - name: hold_control_point
+//	  policy: closing
+//	  max_range: 2000
+//
+// Each tick the first behaviour that wants to move the ship steers it around
+// any scanned asteroids, and every behaviour that fires weapons gets a chance to shoot.
+package pilots
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/golang/glog"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/nav"
+	"github.com/nathanielc/avi/target"
+)
+
+// Name the behaviour pilot is registered with.
+const BehaviorPilotName = "behavior"
+
+func init() {
+	avi.RegisterPilot(BehaviorPilotName, NewBehaviorPilot)
+}
+
+// State of the ship shared with the behaviours each tick.
+type State struct {
+	Tick  int64
+	Scan  avi.ScanResult
+	Pilot *BehaviorPilot
+}
+
+// A Behavior decides where the ship should fly.
+type Behavior interface {
+	// Steer returns the waypoint to fly to this tick,
+	// or false to leave movement to lower priority behaviours.
+	Steer(s *State) (nav.Waypoint, bool)
+}
+
+// Behaviours that implement Shooter also fire weapons.
+type Shooter interface {
+	Shoot(s *State)
+}
+
+// Conf format for a behaviour of the behaviour pilot.
+type BehaviorConf struct {
+	Name   string             `yaml:"name" json:"name"`
+	Params map[string]float64 `yaml:"params" json:"params"`
+}
+
+// Params of a behaviour, missing values take the behaviour's defaults.
+type Params map[string]float64
+
+func (p Params) get(name string, def float64) float64 {
+	if v, ok := p[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Check that only known params are set and none are negative.
+func (p Params) check(known ...string) error {
+	for name, v := range p {
+		found := false
+		for _, k := range known {
+			if k == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("unknown param '%s'", name))
+		}
+		if v < 0 {
+			return errors.New(fmt.Sprintf("param '%s' must not be negative: %f", name, v))
+		}
+	}
+	return nil
+}
+
+type behaviorFactory func(params Params) (Behavior, error)
+
+var registeredBehaviors = make(map[string]behaviorFactory)
+
+// Register a behaviour to make it available to the behaviour pilot.
+func RegisterBehavior(name string, bf behaviorFactory) {
+	registeredBehaviors[name] = bf
+}
+
+// Names of all registered behaviours.
+func Behaviors() []string {
+	names := make([]string, 0, len(registeredBehaviors))
+	for name := range registeredBehaviors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Target selection policies by name.
+var policies = map[string]target.Policy{
+	"nearest": target.Nearest,
+	"closing": target.Closing,
+}
+
+// Params of the behaviour pilot set by pilot_params.
+type pilotParams struct {
+	// Behaviours in priority order
+	Behaviors []BehaviorConf `yaml:"behaviors"`
+	// Name of the policy used to choose targets, defaults to nearest
+	Policy string `yaml:"policy"`
+	// Prefer identified VIPs over other targets
+	VIPFirst bool `yaml:"vip_first"`
+	// Ships farther away are not targeted, zero means unlimited
+	MaxRange float64 `yaml:"max_range"`
+}
+
+// BehaviorPilot flies a ship using the behaviours from its conf.
+type BehaviorPilot struct {
+	avi.GenericPilot
+	Behaviors []Behavior
+	Nav       *nav.Nav
+	Targets   *target.TargetComputer
+	// Health and position of the ship when first scanned
+	MaxHealth float64
+	Home      mgl64.Vec3
+
+	started  bool
+	nextFire []int64
+	router   nav.Router
+}
+
+func NewBehaviorPilot() avi.Pilot {
+	return &BehaviorPilot{}
+}
+
+func (p *BehaviorPilot) Configure(conf avi.ShipConf) error {
+	params := pilotParams{Policy: "nearest"}
+	if err := avi.DecodePilotParams(conf.PilotParams, &params); err != nil {
+		return err
+	}
+	if len(params.Behaviors) == 0 {
+		return errors.New("no behaviors configured")
+	}
+	p.Behaviors = p.Behaviors[0:0]
+	for _, bc := range params.Behaviors {
+		bf, ok := registeredBehaviors[bc.Name]
+		if !ok {
+			return errors.New(fmt.Sprintf("unknown behavior '%s'", bc.Name))
+		}
+		b, err := bf(Params(bc.Params))
+		if err != nil {
+			return errors.New(fmt.Sprintf("behavior '%s': %s", bc.Name, err.Error()))
+		}
+		p.Behaviors = append(p.Behaviors, b)
+	}
+	policy, ok := policies[params.Policy]
+	if !ok {
+		return errors.New(fmt.Sprintf("unknown target policy '%s'", params.Policy))
+	}
+	if params.VIPFirst {
+		policy = target.VIPFirst(policy)
+	}
+	if params.MaxRange < 0 {
+		return errors.New("max_range must not be negative")
+	}
+	p.Targets = target.NewTargetComputer(p.Team)
+	p.Targets.Policy = policy
+	p.Targets.MaxRange = params.MaxRange
+	return nil
+}
+
+func (p *BehaviorPilot) Tick(tick int64) {
+	if p.Nav == nil {
+		p.Nav = nav.NewNav(p.Thrusters)
+		// Weapons start cooling down
+		p.nextFire = make([]int64, len(p.Weapons))
+		for i, w := range p.Weapons {
+			p.nextFire[i] = w.GetCoolDownTicks()
+		}
+	}
+	for _, engine := range p.Engines {
+		engine.PowerOn(1)
+	}
+	if len(p.Sensors) == 0 {
+		return
+	}
+	scan, err := p.Sensors[0].Scan()
+	if err != nil {
+		if glog.V(4) {
+			glog.Infoln("Failed to scan", err)
+		}
+		return
+	}
+	defer scan.Done()
+	if !p.started {
+		p.started = true
+		p.MaxHealth = scan.Health
+		p.Home = scan.Position
+	}
+	p.Targets.Update(tick, scan)
+
+	s := &State{
+		Tick:  tick,
+		Scan:  scan,
+		Pilot: p,
+	}
+	// Hold position unless a behaviour wants to move
+	wp := nav.Waypoint{Position: scan.Position}
+	for _, b := range p.Behaviors {
+		if w, ok := b.Steer(s); ok {
+			wp = w
+			break
+		}
+	}
+	if wp.Position.Sub(scan.Position).Len() < wp.Tolerance {
+		// Arrived, stay put
+		wp = nav.Waypoint{Position: scan.Position}
+	}
+	obstacles := nav.ScanObstacles(scan)
+	p.Nav.SetObstacles(obstacles, scan.Radius)
+	if leg, ok := p.router.Next(scan.Position, wp.Position, obstacles, scan.Radius); ok {
+		// Fly the next leg of the path around the obstacles,
+		// without a path Nav still avoids them when flying straight
+		wp.Position = leg
+		wp.Tolerance = scan.Radius
+	}
+	p.Nav.SetWaypoint(wp)
+	p.DebugWaypoint(wp.Position, wp.Tolerance)
+	if t, ok := p.Targets.Target(scan); ok {
+		p.DebugTarget(t.ID)
+	}
+	if err := p.Nav.Steer(scan.Position, scan.Velocity, scan.Mass); err != nil {
+		if glog.V(4) {
+			glog.Infoln("Failed to navigate", err)
+		}
+	}
+
+	for _, b := range p.Behaviors {
+		if sh, ok := b.(Shooter); ok {
+			sh.Shoot(s)
+		}
+	}
+}
+
+// Fire every weapon that is ready at the track, returns whether any weapon fired.
+func (p *BehaviorPilot) FireAt(s *State, t *target.Track) bool {
+	fired := false
+	for i, w := range p.Weapons {
+		if s.Tick < p.nextFire[i] || w.GetAmmo() <= 0 {
+			continue
+		}
+		dir, flight, ok := p.Targets.Aim(s.Scan, t, w.GetAmmoVel())
+		if !ok {
+			continue
+		}
+		if r := w.GetRange(); r > 0 && flight*w.GetAmmoVel() > r {
+			continue
+		}
+		// Failed shots still spend ammunition, so wait out the cooldown either way
+		p.nextFire[i] = s.Tick + w.GetCoolDownTicks()
+		if err := w.Fire(dir); err != nil {
+			if glog.V(4) {
+				glog.Infoln("Failed to fire", err)
+			}
+			continue
+		}
+		fired = true
+	}
+	return fired
+}
@@ -0,0 +1,352 @@
+package pilots_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/avitest"
+	"github.com/nathanielc/avi/nav"
+	"github.com/nathanielc/avi/pilots"
+)
+
+func newPilot(t *testing.T, behaviors ...pilots.BehaviorConf) *pilots.BehaviorPilot {
+	p := pilots.NewBehaviorPilot().(*pilots.BehaviorPilot)
+	p.JoinFleet("f1")
+	p.JoinTeam("us")
+	if err := p.Configure(avi.ShipConf{PilotParams: map[string]interface{}{"behaviors": behaviors}}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func steer(p *pilots.BehaviorPilot, tick int64, scan avi.ScanResult) (nav.Waypoint, bool) {
+	p.Targets.Update(tick, scan)
+	s := &pilots.State{Tick: tick, Scan: scan, Pilot: p}
+	for _, b := range p.Behaviors {
+		if wp, ok := b.Steer(s); ok {
+			return wp, true
+		}
+	}
+	return nav.Waypoint{}, false
+}
+
+func TestConfigure(t *testing.T) {
+	testCases := []struct {
+		name      string
+		behaviors []pilots.BehaviorConf
+		err       string
+	}{
+		{name: "none", err: "no behaviors"},
+		{name: "unknown", behaviors: []pilots.BehaviorConf{{Name: "dance"}}, err: "unknown behavior 'dance'"},
+		{name: "unknown param", behaviors: []pilots.BehaviorConf{{Name: "hunt", Params: map[string]float64{"speed": 1}}}, err: "unknown param 'speed'"},
+		{name: "negative param", behaviors: []pilots.BehaviorConf{{Name: "kite", Params: map[string]float64{"range": -1}}}, err: "must not be negative"},
+	}
+	for _, tc := range testCases {
+		p := pilots.NewBehaviorPilot().(*pilots.BehaviorPilot)
+		err := p.Configure(avi.ShipConf{PilotParams: map[string]interface{}{"behaviors": tc.behaviors}})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error containing %q got %v", tc.name, tc.err, err)
+		}
+	}
+
+	p := newPilot(t,
+		pilots.BehaviorConf{Name: "evade"},
+		pilots.BehaviorConf{Name: "resupply"},
+		pilots.BehaviorConf{Name: "hunt", Params: map[string]float64{"range": 100}},
+		pilots.BehaviorConf{Name: "hold_control_point"},
+	)
+	if len(p.Behaviors) != 4 {
+		t.Errorf("unexpected behaviors %v", p.Behaviors)
+	}
+}
+
+func TestConfigureErrorRejectsFleet(t *testing.T) {
+	_, err := avi.NewSimulation(
+		avi.MapConf{
+			Radius:         1000,
+			StartingPoints: [][]float64{{0, 0, 0}},
+		},
+		avi.PartSetConf{},
+		[]avi.FleetConf{{
+			Name: "f1",
+			Ships: []avi.ShipConf{{
+				Pilot:       pilots.BehaviorPilotName,
+				PilotParams: map[string]interface{}{"behaviors": []pilots.BehaviorConf{{Name: "dance"}}},
+			}},
+		}},
+		nil,
+		time.Second,
+		60,
+	)
+	if err == nil || !strings.Contains(err.Error(), "unknown behavior 'dance'") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHoldControlPoint(t *testing.T) {
+	p := newPilot(t, pilots.BehaviorConf{Name: "hold_control_point"})
+	scan := avi.ScanResult{
+		ControlPoints: map[avi.ID]avi.CtlPSR{
+			1: {Position: mgl64.Vec3{100, 0, 0}, Points: 1, Influence: 50, Active: true},
+			2: {Position: mgl64.Vec3{200, 0, 0}, Points: 5, Influence: 50, Active: true},
+			3: {Position: mgl64.Vec3{300, 0, 0}, Points: 10, Influence: 50},
+		},
+	}
+	wp, ok := steer(p, 0, scan)
+	if !ok || wp.Position != (mgl64.Vec3{200, 0, 0}) || wp.Tolerance != 25 {
+		t.Errorf("unexpected waypoint %v", wp)
+	}
+
+	if _, ok := steer(p, 1, avi.ScanResult{}); ok {
+		t.Error("expected no waypoint without control points")
+	}
+}
+
+func TestHuntAndKite(t *testing.T) {
+	scan := avi.ScanResult{
+		Position: mgl64.Vec3{0, 0, 0},
+		Ships: map[avi.ID]avi.ShipSR{
+			1: {Team: "them", Position: mgl64.Vec3{1000, 0, 0}},
+			2: {Team: "them", Position: mgl64.Vec3{0, 2000, 0}},
+			3: {Team: "us", Position: mgl64.Vec3{10, 0, 0}},
+		},
+	}
+
+	hunter := newPilot(t, pilots.BehaviorConf{Name: "hunt", Params: map[string]float64{"range": 200}})
+	wp, ok := steer(hunter, 0, scan)
+	if !ok || wp.Position != (mgl64.Vec3{1000, 0, 0}) || wp.Tolerance != 200 {
+		t.Errorf("unexpected hunt waypoint %v", wp)
+	}
+
+	kiter := newPilot(t, pilots.BehaviorConf{Name: "kite", Params: map[string]float64{"range": 600}})
+	wp, ok = steer(kiter, 0, scan)
+	if !ok || wp.Position.Sub(mgl64.Vec3{400, 0, 0}).Len() > 1e-9 {
+		t.Errorf("unexpected kite waypoint %v", wp)
+	}
+
+	// Without enemies lower priority behaviours steer
+	p := newPilot(t, pilots.BehaviorConf{Name: "hunt"}, pilots.BehaviorConf{Name: "hold_control_point"})
+	wp, ok = steer(p, 0, avi.ScanResult{
+		ControlPoints: map[avi.ID]avi.CtlPSR{
+			4: {Position: mgl64.Vec3{0, 0, 50}, Points: 1, Influence: 10, Active: true},
+		},
+	})
+	if !ok || wp.Position != (mgl64.Vec3{0, 0, 50}) {
+		t.Errorf("unexpected fallback waypoint %v", wp)
+	}
+}
+
+func TestEvade(t *testing.T) {
+	p := newPilot(t, pilots.BehaviorConf{Name: "evade"})
+	scan := avi.ScanResult{
+		Radius: 5,
+		Projectiles: []avi.ProjectileSR{
+			// Our own projectile is ignored
+			{Team: "us", Position: mgl64.Vec3{-10, 0, 0}, Velocity: mgl64.Vec3{100, 0, 0}},
+			// Passing well clear
+			{Team: "them", Position: mgl64.Vec3{-100, 100, 0}, Velocity: mgl64.Vec3{100, 0, 0}},
+		},
+	}
+	if wp, ok := steer(p, 0, scan); ok {
+		t.Errorf("unexpected evasion %v", wp)
+	}
+
+	// Incoming slightly above the ship, dodge downwards
+	scan.Projectiles = append(scan.Projectiles, avi.ProjectileSR{
+		Team:     "them",
+		Position: mgl64.Vec3{-100, 0, 2},
+		Velocity: mgl64.Vec3{100, 0, 0},
+	})
+	wp, ok := steer(p, 0, scan)
+	if !ok || wp.Position.Z() >= 0 {
+		t.Errorf("unexpected evasion %v", wp)
+	}
+}
+
+func TestResupply(t *testing.T) {
+	p := newPilot(t, pilots.BehaviorConf{Name: "resupply", Params: map[string]float64{"health": 0.5}})
+	p.MaxHealth = 100
+	p.Home = mgl64.Vec3{-50, 0, 0}
+	scan := avi.ScanResult{
+		Health: 90,
+		Zones: []avi.ZoneSR{
+			{Shape: avi.ZoneSphere, Position: mgl64.Vec3{500, 0, 0}, Radius: 40, Repair: 1},
+			{Shape: avi.ZoneSphere, Position: mgl64.Vec3{100, 0, 0}, Radius: 40, Repair: 1, Damage: 1},
+			{Shape: avi.ZoneSphere, Position: mgl64.Vec3{200, 0, 0}, Radius: 40, Resupply: 1},
+		},
+	}
+	// Lightly damaged, keep fighting
+	if wp, ok := steer(p, 0, scan); ok {
+		t.Errorf("unexpected return %v", wp)
+	}
+	// Badly damaged, return to the nearest safe repair zone
+	scan.Health = 40
+	wp, ok := steer(p, 1, scan)
+	if !ok || wp.Position != (mgl64.Vec3{500, 0, 0}) || wp.Tolerance != 20 {
+		t.Errorf("unexpected waypoint %v", wp)
+	}
+	// Stay until fully repaired
+	scan.Health = 90
+	if _, ok := steer(p, 2, scan); !ok {
+		t.Error("expected to stay until repaired")
+	}
+	scan.Health = 100
+	if wp, ok := steer(p, 3, scan); ok {
+		t.Errorf("unexpected return %v", wp)
+	}
+	// Without a zone there is nowhere to go, keep fighting
+	scan.Health = 10
+	scan.Zones = nil
+	if wp, ok := steer(p, 4, scan); ok {
+		t.Errorf("unexpected return %v", wp)
+	}
+}
+
+func TestPilotParams(t *testing.T) {
+	p := pilots.NewBehaviorPilot().(*pilots.BehaviorPilot)
+	err := p.Configure(avi.ShipConf{
+		PilotParams: map[string]interface{}{
+			"behaviors": []pilots.BehaviorConf{{Name: "hunt"}},
+			"policy":    "closing",
+			"vip_first": true,
+			"max_range": 700,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Targets.MaxRange != 700 {
+		t.Errorf("unexpected max range %f", p.Targets.MaxRange)
+	}
+	scan := avi.ScanResult{
+		Ships: map[avi.ID]avi.ShipSR{
+			1: {Position: mgl64.Vec3{100, 0, 0}},
+			2: {Position: mgl64.Vec3{0, 600, 0}, VIP: true},
+		},
+	}
+	p.Targets.Update(0, scan)
+	if tr, ok := p.Targets.Target(scan); !ok || tr.ID != 2 {
+		t.Errorf("expected the VIP as target, got %v", tr)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"policy": "random"},
+		{"max_range": -1},
+		{"range": 10},
+	} {
+		params["behaviors"] = []pilots.BehaviorConf{{Name: "hunt"}}
+		p := pilots.NewBehaviorPilot().(*pilots.BehaviorPilot)
+		if err := p.Configure(avi.ShipConf{PilotParams: params}); err == nil {
+			t.Errorf("expected error for params %v", params)
+		}
+	}
+}
+
+const holders = `
+name: holders
+ships:
+  - pilot: behavior
+    position: [0, 0, 0]
+    hull_strength: 100
+    pilot_params:
+      behaviors:
+        - name: hold_control_point
+    parts:
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+      - {name: rocket, type: thruster, position: [20, 0, 0]}
+      - {name: rocket, type: thruster, position: [-20, 0, 0]}
+      - {name: antenna, type: sensor, position: [0, 0, -12]}
+`
+
+func TestRouteAroundAsteroid(t *testing.T) {
+	s := avitest.New(t, `
+control_points:
+  - {position: [0, 0, 600], radius: 10, mass: 1e6, points: 1, influence: 100}
+asteroids:
+  - {position: [0, 0, 300], radius: 50, mass: 1e9}
+`, holders)
+	id := s.Fleet("holders")[0].ID
+	closest := math.Inf(1)
+	clear := func(s *avitest.Sim) bool {
+		if ship, ok := s.Ship(id); ok {
+			d := ship.Position.Sub(mgl64.Vec3{0, 0, 300}).Len() - ship.Radius - 50
+			closest = math.Min(closest, d)
+		}
+		return true
+	}
+	s.AssertWithin(time.Minute, avitest.All(clear, avitest.Reached(id, mgl64.Vec3{0, 0, 600}, 50)), "reached control point")
+	if closest <= 0 {
+		t.Errorf("ship hit the asteroid, closest approach %f", closest)
+	}
+}
+
+const hunters = `
+name: hunters
+ships:
+  - pilot: behavior
+    position: [0, 0, 0]
+    hull_strength: 100
+    pilot_params:
+      behaviors:
+        - name: resupply
+          params: {ammo: 1}
+        - name: hunt
+          params: {range: 300}
+    parts:
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+      - {name: rocket, type: thruster, position: [20, 0, 0]}
+      - {name: rocket, type: thruster, position: [-20, 0, 0]}
+      - {name: rifle, type: weapon, position: [0, 15, 0]}
+      - {name: antenna, type: sensor, position: [0, 0, -12]}
+`
+
+const prey = `
+position: [800, 0, 0]
+hull_strength: 1e6
+parts:
+  - {name: nuclear, type: engine, position: [0, 0, 0]}
+`
+
+func TestHuntInSimulation(t *testing.T) {
+	s := avitest.New(t, ``, hunters)
+	hunter := s.Fleet("hunters")[0]
+	s.AddScripted("prey", prey, nil)
+	rifle := hunter.Pilot.(*pilots.BehaviorPilot).Weapons[0]
+
+	// Firing once drains the ammo below the resupply threshold,
+	// without a resupply zone the hunter keeps closing in and firing
+	if !s.AssertWithin(30*time.Second, avitest.All(
+		avitest.Hit(hunter.ID, 3),
+		avitest.Reached(hunter.ID, mgl64.Vec3{800, 0, 0}, 350),
+	), "closed in and hit prey") {
+		return
+	}
+	// Weapons only fire once they have cooled down
+	fired := rifle.GetAmmoCapacity() - rifle.GetAmmo()
+	if max := s.CurrentTick()/rifle.GetCoolDownTicks() + 1; fired > max {
+		t.Errorf("fired %d shots in %d ticks, at most %d expected", fired, s.CurrentTick(), max)
+	}
+
+	// Holds position once within range of the prey
+	ship, _ := s.Ship(hunter.ID)
+	s.AssertNever(5*time.Second, func(s *avitest.Sim) bool {
+		now, _ := s.Ship(hunter.ID)
+		return now.Position.Sub(ship.Position).Len() > 300
+	}, "drifted away")
+}
+
+func TestFireOutOfRange(t *testing.T) {
+	s := avitest.NewWithParts(t, strings.Replace(avitest.DefaultParts, "cooldown: 1", "cooldown: 1\n    range: 200", 1), ``, strings.Replace(hunters, "range: 300", "range: 1000", 1))
+	hunter := s.Fleet("hunters")[0]
+	s.AddScripted("prey", prey, nil)
+	rifle := hunter.Pilot.(*pilots.BehaviorPilot).Weapons[0]
+
+	s.Run(5 * time.Second)
+	if rifle.GetAmmo() != rifle.GetAmmoCapacity() {
+		t.Errorf("fired %d shots at a target out of range", rifle.GetAmmoCapacity()-rifle.GetAmmo())
+	}
+}
@@ -1,11 +1,70 @@
 package avi
 
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
 const projectileTexture = "projectile"
 
+// Projectiles slowed by drag below this speed are removed.
+const minProjectileSpeed = 1.0
+
 type projectile struct {
 	objectT
+	// Team of the ship that fired the projectile
+	team string
+	// Ship that fired the projectile, nil for projectiles not fired by a ship
+	shooter *shipT
+	// Tick after which the projectile is removed, zero means never.
+	expires int64
+	// Position the projectile was fired from.
+	origin mgl64.Vec3
+	// Maximum distance from the origin, zero means unlimited.
+	maxRange float64
+	// Velocity multiplier applied each tick because of drag, zero means no drag.
+	dragFactor float64
+	// Whether the projectile has already collided with something.
+	dead bool
+}
+
+func newProjectile(pos, vel mgl64.Vec3, mass, radius float64) *projectile {
+	return &projectile{
+		objectT: objectT{
+			position: pos,
+			velocity: vel,
+			mass:     mass,
+			radius:   radius,
+		},
+		origin: pos,
+	}
 }
 
 func (projectile) Texture() string {
 	return projectileTexture
 }
+
+// Set the exponential rate per second at which the projectile loses velocity.
+func (p *projectile) setDrag(drag float64) {
+	if drag > 0 {
+		p.dragFactor = math.Exp(-drag * SecondsPerTick)
+	}
+}
+
+func (p *projectile) applyDrag() {
+	if p.dragFactor > 0 {
+		p.velocity = p.velocity.Mul(p.dragFactor)
+	}
+}
+
+// Reports whether the projectile has outlived its lifetime, range or speed.
+func (p *projectile) expired(tick int64) bool {
+	if p.expires > 0 && tick >= p.expires {
+		return true
+	}
+	if p.maxRange > 0 && LengthSq(p.position.Sub(p.origin)) > p.maxRange*p.maxRange {
+		return true
+	}
+	return p.dragFactor > 0 && LengthSq(p.velocity) < minProjectileSpeed*minProjectileSpeed
+}
@@ -0,0 +1,127 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/golang/glog"
+)
+
+const defaultRespawnDelay = 5
+
+// Conf format for respawning destroyed ships.
+// Respawning is disabled unless lives is non-zero.
+type RespawnConf struct {
+	// Time in seconds before a destroyed ship respawns, defaults to 5.
+	Delay float64 `yaml:"delay" json:"delay"`
+	// Number of times each ship can respawn, -1 means unlimited.
+	Lives int `yaml:"lives" json:"lives"`
+	// Total mass of respawned ships allowed for each fleet, zero means unlimited.
+	MassBudget float64 `yaml:"mass_budget" json:"mass_budget"`
+}
+
+func (c RespawnConf) withDefaults() RespawnConf {
+	if c.Delay == 0 {
+		c.Delay = defaultRespawnDelay
+	}
+	return c
+}
+
+func (c RespawnConf) Validate() error {
+	if c.Delay < 0 || c.MassBudget < 0 {
+		return errors.New("respawn delay and mass_budget must not be negative")
+	}
+	if c.Lives < -1 {
+		return errors.New(fmt.Sprintf("respawn lives must be -1 or more: %d", c.Lives))
+	}
+	return nil
+}
+
+// Pilots that implement Respawner are reused when their ship respawns,
+// otherwise a new pilot is created for the respawned ship.
+type Respawner interface {
+	// Called after the pilot's new ship has been added to the simulation.
+	Respawned()
+}
+
+// A destroyed ship waiting to respawn.
+type respawn struct {
+	tick     int64
+	fleet    string
+	team     string
+	position mgl64.Vec3
+	pilot    Pilot
+	conf     ShipConf
+	lives    int
+}
+
+// Queues a destroyed ship to respawn, returns false if it has no lives left
+// or its fleet has spent its mass budget.
+// The budget is charged the mass of the rebuilt ship, not the wreck.
+// VIPs never respawn.
+func (sim *Simulation) queueRespawn(ship *shipT) bool {
+	if ship.lives == 0 || ship.vip {
+		return false
+	}
+	if budget := sim.respawn.MassBudget; budget > 0 {
+		if sim.reinforcements[ship.fleet]+ship.builtMass > budget {
+			return false
+		}
+		sim.reinforcements[ship.fleet] += ship.builtMass
+	}
+	pilot := ship.pilot
+	if _, ok := pilot.(Respawner); !ok {
+		var err error
+		pilot, err = newPilot(ship.conf, ship.fleet, ship.team)
+		if err != nil {
+			return false
+		}
+	}
+	lives := ship.lives
+	if lives > 0 {
+		lives--
+	}
+	sim.respawns = append(sim.respawns, respawn{
+		tick:     sim.tick + int64(sim.respawn.Delay/SecondsPerTick),
+		fleet:    ship.fleet,
+		team:     ship.team,
+		position: ship.spawn,
+		pilot:    pilot,
+		conf:     ship.conf,
+		lives:    lives,
+	})
+	return true
+}
+
+// Adds back all ships whose respawn delay has passed.
+func (sim *Simulation) respawnShips() {
+	pending := sim.respawns[0:0]
+	for _, r := range sim.respawns {
+		if r.tick > sim.tick {
+			pending = append(pending, r)
+			continue
+		}
+		ship, err := sim.AddShip(r.fleet, r.position, r.pilot, r.conf)
+		if err != nil {
+			glog.Errorf("Failed to respawn ship for fleet '%s': %s", r.fleet, err)
+			closePilot(r.pilot)
+			continue
+		}
+		ship.lives = r.lives
+		if rp, ok := r.pilot.(Respawner); ok {
+			rp.Respawned()
+		}
+	}
+	sim.respawns = pending
+}
+
+// Whether the team has a ship waiting to respawn.
+func (sim *Simulation) respawning(team string) bool {
+	for _, r := range sim.respawns {
+		if r.team == team {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,13 @@ import (
 
 const detectionThreshold = 0.0
 
+// Intensity needed to detect a projectile, they are small enough that
+// a sensor with a power of 1 only detects them within 250m.
+const projectileDetectionThreshold = 1 / (4 * math.Pi * 250 * 250)
+
+// Intensity needed to identify details of a detected ship, such as whether it is a VIP.
+const identificationThreshold = 1e-5
+
 var NoScanAvalaible = errors.New("No scan available")
 
 type Sensor struct {
@@ -63,6 +70,8 @@ func NewSensorFromConf(pos mgl64.Vec3, conf SensorConf) *Sensor {
 }
 
 type ScanResult struct {
+	// ID of the scanning ship.
+	ID            ID
 	Position      mgl64.Vec3
 	Velocity      mgl64.Vec3
 	Mass          float64
@@ -70,6 +79,24 @@ type ScanResult struct {
 	Health        float64
 	Ships         map[ID]ShipSR
 	ControlPoints map[ID]CtlPSR
+	Boundary      BoundarySR
+	// Zones on the map, shared between all scans and must not be modified.
+	Zones []ZoneSR
+	// Flags on the map, shared between all scans and must not be modified.
+	Flags []FlagSR
+	// IDs of objects attached to the ship.
+	Attached []ID
+	// Race checkpoints in order, shared between all scans and must not be modified.
+	Checkpoints []CheckpointSR
+	// Index of the next checkpoint to pass and number of completed laps.
+	NextCheckpoint int
+	Lap            int
+	// Messages from fleet mates broadcast since the last successful scan, must not be modified.
+	Messages []Message
+	// Projectiles close enough to detect, more powerful sensors detect them farther away.
+	Projectiles []ProjectileSR
+	// Asteroids and other inert obstacles detected by the sensor.
+	Asteroids []AsteroidSR
 
 	ships *sync.Pool
 	ctlps *sync.Pool
@@ -95,6 +122,23 @@ type ShipSR struct {
 	Velocity mgl64.Vec3
 	Radius   float64
 	Fleet    string
+	Team     string
+	// Whether the ship is a VIP, only known if the signal is strong enough.
+	VIP bool
+}
+
+type ProjectileSR struct {
+	Position mgl64.Vec3
+	Velocity mgl64.Vec3
+	Radius   float64
+	// Team that fired the projectile
+	Team string
+}
+
+type AsteroidSR struct {
+	Position mgl64.Vec3
+	Velocity mgl64.Vec3
+	Radius   float64
 }
 
 type CtlPSR struct {
@@ -103,6 +147,15 @@ type CtlPSR struct {
 	Radius    float64
 	Points    float64
 	Influence float64
+	// Fleet that owns the control point, empty if not owned
+	Owner string
+	// Fleet the capture progress belongs to
+	Capturer string
+	// Capture progress between 0 and 1
+	Progress  float64
+	Contested bool
+	// Inactive control points cannot be captured and do not score
+	Active bool
 }
 
 func (self *Sensor) Scan() (ScanResult, error) {
@@ -117,19 +170,32 @@ func (self *Sensor) Scan() (ScanResult, error) {
 	}
 	scan := self.lastScan
 	self.lastScan = ScanResult{
-		Position:      self.ship.position,
-		Velocity:      self.ship.velocity,
-		Mass:          self.ship.mass,
-		Radius:        self.ship.radius,
-		Health:        self.ship.health,
-		Ships:         self.searchShips(),
-		ControlPoints: self.searchCPs(),
-		ships:         &self.ships,
-		ctlps:         &self.ctlps,
+		ID:             self.ship.ID(),
+		Position:       self.ship.position,
+		Velocity:       self.ship.velocity,
+		Mass:           self.ship.mass,
+		Radius:         self.ship.radius,
+		Health:         self.ship.health,
+		Ships:          self.searchShips(),
+		ControlPoints:  self.searchCPs(),
+		Projectiles:    self.searchProjectiles(),
+		Asteroids:      self.searchAsteroids(),
+		Boundary:       self.ship.sim.boundary.scan(self.ship.sim.tick),
+		Zones:          self.ship.sim.zoneSRs,
+		Flags:          self.ship.sim.flagSRs,
+		Attached:       self.ship.sim.attachedIDs(self.ship),
+		Checkpoints:    self.ship.sim.checkpointSRs,
+		NextCheckpoint: self.ship.nextCheckpoint,
+		Lap:            self.ship.lap,
+		ships:          &self.ships,
+		ctlps:          &self.ctlps,
 	}
 	if scan.Ships == nil {
 		return ScanResult{}, NoScanAvalaible
 	}
+	// Messages wait in the inbox until a scan succeeds
+	scan.Messages = self.ship.inbox
+	self.ship.inbox = nil
 	return scan, nil
 }
 
@@ -142,14 +208,17 @@ func (self *Sensor) searchShips() map[ID]ShipSR {
 
 		distance2 := LengthSq(ship.position.Sub(self.ship.position))
 
-		i := self.intensity(distance2)
+		// Zones dampen the signal at both the target and the sensor
+		i := self.intensity(distance2) * (1 - ship.dampening) * (1 - self.ship.dampening)
 
 		if i > detectionThreshold {
 			ships[ship.ID()] = ShipSR{
 				Fleet:    ship.fleet,
+				Team:     ship.team,
 				Position: ship.position,
 				Velocity: ship.velocity,
 				Radius:   ship.radius,
+				VIP:      ship.vip && i > identificationThreshold,
 			}
 		}
 	}
@@ -157,6 +226,42 @@ func (self *Sensor) searchShips() map[ID]ShipSR {
 	return ships
 }
 
+func (self *Sensor) searchProjectiles() []ProjectileSR {
+	var projs []ProjectileSR
+	sim := self.ship.sim
+	pos := self.ship.position
+	// Farthest a projectile can be detected, ignoring dampening
+	rng := math.Sqrt(self.power / (4 * math.Pi * projectileDetectionThreshold))
+	sim.projGrid.near(pos, rng, func(p *projectile) {
+		i := self.intensity(LengthSq(p.position.Sub(pos))) * (1 - sim.dampeningAt(p.position)) * (1 - self.ship.dampening)
+		if i <= projectileDetectionThreshold {
+			return
+		}
+		projs = append(projs, ProjectileSR{
+			Position: p.position,
+			Velocity: p.velocity,
+			Radius:   p.radius,
+			Team:     p.team,
+		})
+	})
+	return projs
+}
+
+func (self *Sensor) searchAsteroids() []AsteroidSR {
+	var astds []AsteroidSR
+	for _, a := range self.ship.sim.astds {
+		distance2 := LengthSq(a.position.Sub(self.ship.position))
+		if self.intensity(distance2)*(1-self.ship.dampening) > detectionThreshold {
+			astds = append(astds, AsteroidSR{
+				Position: a.position,
+				Velocity: a.velocity,
+				Radius:   a.radius,
+			})
+		}
+	}
+	return astds
+}
+
 func (self *Sensor) searchCPs() map[ID]CtlPSR {
 	ctlps := self.ctlps.Get().(map[ID]CtlPSR)
 	for _, ctlp := range self.ship.sim.ctlps {
@@ -171,6 +276,11 @@ func (self *Sensor) searchCPs() map[ID]CtlPSR {
 				Radius:    ctlp.radius,
 				Points:    ctlp.points,
 				Influence: ctlp.influence,
+				Owner:     ctlp.owner,
+				Capturer:  ctlp.capturer,
+				Progress:  ctlp.progress,
+				Contested: ctlp.contested,
+				Active:    !ctlp.inactive,
 			}
 		}
 	}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/go-gl/mathgl/mgl64"
 	"github.com/golang/glog"
 	"github.com/nathanielc/avi"
 	"github.com/nathanielc/gdvariant"
@@ -28,6 +30,11 @@ type game struct {
 	enc      *gdvariant.Encoder
 	buf      bytes.Buffer
 
+	// Events logged since the last frame
+	events []Event
+	// Debug shapes drawn for the next frame
+	debug []Debug
+
 	mu      sync.RWMutex
 	running bool
 	wg      sync.WaitGroup
@@ -131,6 +138,37 @@ func (g *game) Stream(startFrame, stopFrame int) (*Stream, error) {
 	return s, err
 }
 
+func (g *game) LogEvent(t float64, name, action string) {
+	g.events = append(g.events, Event{
+		Time:   float32(t),
+		Name:   name,
+		Action: action,
+	})
+}
+
+func (g *game) DrawDebug(t float64, shapes map[avi.ID][]avi.DebugShape) {
+	// Sort by ship so replays are reproducible
+	ids := make([]int, 0, len(shapes))
+	for id := range shapes {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		for _, s := range shapes[avi.ID(id)] {
+			g.debug = append(g.debug, Debug{
+				Ship:     uint32(id),
+				Kind:     s.Kind,
+				Position: toVector3(s.Position),
+				End:      toVector3(s.End),
+				Radius:   float32(s.Radius * scale),
+				Text:     s.Text,
+				Target:   uint32(s.Target),
+				Color:    s.Color,
+			})
+		}
+	}
+}
+
 func (g *game) Draw(t float64, scores map[string]float64, new, existing []avi.Drawable, deleted []avi.ID) {
 	var frame Frame
 	frame.Time = float32(t)
@@ -140,31 +178,22 @@ func (g *game) Draw(t float64, scores map[string]float64, new, existing []avi.Dr
 		frame.Scores[fleet] = float32(score)
 	}
 
-	frame.Objects = make([]Object, len(new)+len(existing))
-	for i, d := range new {
-		p := d.Position()
-		frame.Objects[i] = Object{
-			ID: uint32(d.ID()),
-			Position: gdvariant.Vector3{
-				X: float32(p.X() * scale),
-				Y: float32(p.Y() * scale),
-				Z: float32(p.Z() * scale),
-			},
-			Radius: float32(d.Radius() * scale),
-			Model:  d.Texture(),
-		}
-	}
-	for i, d := range existing {
-		p := d.Position()
-		frame.Objects[i] = Object{
-			ID: uint32(d.ID()),
-			Position: gdvariant.Vector3{
-				X: float32(p.X() * scale),
-				Y: float32(p.Y() * scale),
-				Z: float32(p.Z() * scale),
-			},
-			Radius: float32(d.Radius() * scale),
-			Model:  d.Texture(),
+	frame.Objects = make([]Object, 0, len(new)+len(existing))
+	for _, ds := range [][]avi.Drawable{new, existing} {
+		for _, d := range ds {
+			frame.Objects = append(frame.Objects, newObject(d))
+			if c, ok := d.(avi.Capturable); ok {
+				cp := ControlPoint{
+					ID:       uint32(d.ID()),
+					Owner:    c.Owner(),
+					Capturer: c.Capturer(),
+					Progress: float32(c.Progress()),
+				}
+				if c.Contested() {
+					cp.Contested = 1
+				}
+				frame.ControlPoints = append(frame.ControlPoints, cp)
+			}
 		}
 	}
 
@@ -181,6 +210,12 @@ func (g *game) Draw(t float64, scores map[string]float64, new, existing []avi.Dr
 	//	}
 	//}
 
+	frame.Events = g.events
+	g.events = nil
+
+	frame.Debug = g.debug
+	g.debug = nil
+
 	frame.DeletedObjects = make([]uint32, len(deleted))
 	for i, v := range deleted {
 		frame.DeletedObjects[i] = uint32(v)
@@ -196,6 +231,49 @@ func (g *game) Draw(t float64, scores map[string]float64, new, existing []avi.Dr
 	}
 }
 
+func newObject(d avi.Drawable) Object {
+	p := d.Position()
+	o := Object{
+		ID: uint32(d.ID()),
+		Position: gdvariant.Vector3{
+			X: float32(p.X() * scale),
+			Y: float32(p.Y() * scale),
+			Z: float32(p.Z() * scale),
+		},
+		Radius: float32(d.Radius() * scale),
+		Model:  d.Texture(),
+	}
+	if s, ok := d.(avi.Sized); ok {
+		size := s.Size()
+		o.Size = gdvariant.Vector3{
+			X: float32(size.X() * scale),
+			Y: float32(size.Y() * scale),
+			Z: float32(size.Z() * scale),
+		}
+	}
+	if a, ok := d.(avi.Attached); ok {
+		if parent, attached := a.Parent(); attached {
+			offset := a.Offset()
+			o.Attached = 1
+			o.Parent = uint32(parent)
+			o.Position = gdvariant.Vector3{
+				X: float32(offset.X() * scale),
+				Y: float32(offset.Y() * scale),
+				Z: float32(offset.Z() * scale),
+			}
+		}
+	}
+	return o
+}
+
+func toVector3(v mgl64.Vec3) gdvariant.Vector3 {
+	return gdvariant.Vector3{
+		X: float32(v.X() * scale),
+		Y: float32(v.Y() * scale),
+		Z: float32(v.Z() * scale),
+	}
+}
+
 func (g *game) encodeObj(o interface{}) error {
 	// Encode object to buffer
 	if err := g.enc.Encode(o); err != nil {
@@ -149,8 +149,12 @@ type startGameRequest struct {
 	Map     string   `json:"map"`
 	PartSet string   `json:"part_set"`
 	Fleets  []string `json:"fleets"`
+	// Team of each fleet, by index. Empty teams use the team from the fleet config.
+	Teams   []string `json:"teams"`
 	FPS     int      `json:"fps"`
 	MaxTime int64    `json:"max_time"`
+	// Record the debug shapes drawn by pilots in the replay.
+	Debug bool `json:"debug"`
 }
 
 type startGameResponse struct {
@@ -193,6 +197,9 @@ func (h *Handler) startGame(w http.ResponseWriter, r *http.Request) {
 			h.error(w, fmt.Sprintf("unknown fleet %q: %v", f, err), http.StatusNotFound)
 			return
 		}
+		if i < len(sgr.Teams) && sgr.Teams[i] != "" {
+			fleet.Team = sgr.Teams[i]
+		}
 		fleets[i] = fleet
 	}
 
@@ -217,6 +224,9 @@ func (h *Handler) startGame(w http.ResponseWriter, r *http.Request) {
 		h.error(w, fmt.Sprintf("failed to create simulation: %v", err), http.StatusNotFound)
 		return
 	}
+	if sgr.Debug {
+		sim.EnableDebug()
+	}
 
 	if err := g.Start(sim); err != nil {
 		h.error(w, fmt.Sprintf("failed to start game: %v", err), http.StatusNotFound)
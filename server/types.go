@@ -7,6 +7,12 @@ type Object struct {
 	Position gdvariant.Vector3
 	Radius   float32
 	Model    string
+	// Dimensions of non spherical objects, zero otherwise.
+	Size gdvariant.Vector3
+	// 1 if the object is attached to the Parent object,
+	// in which case Position is relative to the parent.
+	Attached uint8
+	Parent   uint32
 }
 
 //type ObjectUpdate struct {
@@ -14,11 +20,48 @@ type Object struct {
 //	Position gdvariant.Vector3
 //}
 
+// Capture state of a control point
+type ControlPoint struct {
+	ID       uint32
+	Owner    string
+	Capturer string
+	Progress float32
+	// 1 if the control point is contested, booleans cannot be encoded.
+	Contested uint8
+}
+
+// A scripted map event that fired
+type Event struct {
+	Time   float32
+	Name   string
+	Action string
+}
+
+// A debug shape drawn by the pilot of a ship
+type Debug struct {
+	Ship uint32
+	Kind string
+	// Start of lines, centre of spheres and position of labels and waypoints.
+	Position gdvariant.Vector3
+	// End of lines.
+	End    gdvariant.Vector3
+	Radius float32
+	Text   string
+	Target uint32
+	// Color as an HTML hex string, empty uses the default for the kind.
+	Color string
+}
+
 type Frame struct {
 	Time           float32
 	Scores         map[string]float32
 	Objects        []Object
 	DeletedObjects []uint32
+	ControlPoints  []ControlPoint
+	// Events that fired since the previous frame
+	Events []Event
+	// Debug shapes drawn by pilots, kept apart so heads can toggle them
+	Debug []Debug
 }
 
 type Meta struct {
@@ -29,6 +29,25 @@ func TestObject(t *testing.T) {
 				Model:    "borg",
 			},
 		},
+		{
+			obj: server.Object{
+				ID:       7,
+				Position: gdvariant.Vector3{X: 5, Y: 0, Z: 1},
+				Radius:   3,
+				Model:    "zone",
+				Size:     gdvariant.Vector3{X: 4, Y: 2, Z: 2},
+			},
+		},
+		{
+			obj: server.Object{
+				ID:       9,
+				Position: gdvariant.Vector3{X: 0, Y: 0, Z: 1},
+				Radius:   1,
+				Model:    "flag",
+				Attached: 1,
+				Parent:   4,
+			},
+		},
 	}
 	for _, tc := range testCases {
 		var buf bytes.Buffer
@@ -45,6 +64,51 @@ func TestObject(t *testing.T) {
 	}
 }
 
+func TestControlPoint(t *testing.T) {
+	cp := server.ControlPoint{
+		ID:        3,
+		Owner:     "red",
+		Capturer:  "blue",
+		Progress:  0.5,
+		Contested: 1,
+	}
+	var buf bytes.Buffer
+	if err := gdvariant.NewEncoder(&buf).Encode(cp); err != nil {
+		t.Fatal(err)
+	}
+	var got server.ControlPoint
+	if err := gdvariant.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cp) {
+		t.Errorf("unexpected control point:\ngot\n%+v\nexp\n%+v\n", got, cp)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	d := server.Debug{
+		Ship:     7,
+		Kind:     "line",
+		Position: gdvariant.Vector3{X: 1, Y: 2, Z: 3},
+		End:      gdvariant.Vector3{X: -1, Y: 0, Z: 4},
+		Radius:   2,
+		Text:     "target",
+		Target:   9,
+		Color:    "#ff0000",
+	}
+	var buf bytes.Buffer
+	if err := gdvariant.NewEncoder(&buf).Encode(d); err != nil {
+		t.Fatal(err)
+	}
+	var got server.Debug
+	if err := gdvariant.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("unexpected debug shape:\ngot\n%+v\nexp\n%+v\n", got, d)
+	}
+}
+
 //func TestFrame(t *testing.T) {
 //	testCases := []struct {
 //		frame server.Frame
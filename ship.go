@@ -14,6 +14,7 @@ var thrusterType = reflect.TypeOf(&Thruster{})
 var engineType = reflect.TypeOf(&Engine{})
 var weaponType = reflect.TypeOf(&Weapon{})
 var sensorType = reflect.TypeOf(&Sensor{})
+var commsType = reflect.TypeOf(&Comms{})
 
 type ShipConf struct {
 	Pilot        string         `yaml:"pilot" json:"pilot"`
@@ -21,12 +22,17 @@ type ShipConf struct {
 	HullStrength float64        `yaml:"hull_strength" json:"hull_strength"`
 	Position     []float64      `yaml:"position" json:"position"`
 	Parts        []ShipPartConf `yaml:"parts" json:"parts"`
+	// Whether the ship is its fleet's VIP, vip mode needs exactly one VIP per fleet.
+	VIP bool `yaml:"vip" json:"vip"`
+	// Free-form parameters for the pilot, only allowed for configurable pilots.
+	PilotParams map[string]interface{} `yaml:"pilot_params" json:"pilot_params"`
 }
 
 //Internal representaion of the ship
 type shipT struct {
 	pilot   Pilot
 	fleet   string
+	team    string
 	sim     *Simulation
 	texture string
 	objectT
@@ -35,8 +41,37 @@ type shipT struct {
 	weapons       []*Weapon
 	engines       []*Engine
 	sensors       []*Sensor
+	comms         []*Comms
 	totalEnergy   float64
 	currentEnergy float64
+	// Fraction of engine output lost to zones
+	energyDrain float64
+	// Fraction of sensor intensity lost to zones
+	dampening float64
+	// Team that last damaged the ship
+	lastAttacker string
+	// Number of the ship's projectiles that hit ships of other teams
+	hits int
+	// Conf and position the ship respawns with
+	conf  ShipConf
+	spawn mgl64.Vec3
+	// Remaining respawns, -1 means unlimited
+	lives int
+	// Tick the ship was added to the simulation
+	spawned int64
+	// Race progress
+	nextCheckpoint int
+	lap            int
+	finished       bool
+	vip            bool
+	// Neutral ships belong to no competing fleet
+	npc bool
+	// Messages delivered last tick
+	inbox []Message
+	// Health the ship was built with, repairs never exceed it
+	maxHealth float64
+	// Mass the ship was built with, before any ammunition was spent
+	builtMass float64
 }
 
 func newShip(id ID, sim *Simulation, fleet string, pos mgl64.Vec3, pilot Pilot, conf ShipConf) (*shipT, error) {
@@ -51,6 +86,9 @@ func newShip(id ID, sim *Simulation, fleet string, pos mgl64.Vec3, pilot Pilot,
 		weapons:   make([]*Weapon, 0),
 		sensors:   make([]*Sensor, 0),
 		texture:   conf.Texture,
+		conf:      conf,
+		spawn:     pos,
+		vip:       conf.VIP,
 	}
 
 	newShip.id = id
@@ -61,8 +99,10 @@ func newShip(id ID, sim *Simulation, fleet string, pos mgl64.Vec3, pilot Pilot,
 		return nil, err
 	}
 
+	newShip.builtMass = newShip.mass
 	newShip.determineSize()
 	newShip.health = conf.HullStrength * 4 * math.Pi * newShip.radius
+	newShip.maxHealth = newShip.health
 
 	return newShip, nil
 }
@@ -95,6 +135,9 @@ func (ship *shipT) addParts(partsConf []ShipPartConf) error {
 		case sensorType:
 			s := part.(*Sensor)
 			ship.sensors = append(ship.sensors, s)
+		case commsType:
+			c := part.(*Comms)
+			ship.comms = append(ship.comms, c)
 		}
 	}
 	// Check for colliding parts
@@ -135,6 +178,7 @@ func (ship *shipT) Energize() {
 	for _, engine := range ship.engines {
 		ship.totalEnergy += engine.getOutput()
 	}
+	ship.totalEnergy *= 1 - ship.energyDrain
 	ship.currentEnergy = ship.totalEnergy
 }
 
@@ -160,7 +204,13 @@ func (ship *shipT) ApplyAcc(dir mgl64.Vec3) {
 }
 
 func (ship *shipT) Tick() {
+	if d, ok := ship.pilot.(debugPilot); ok {
+		d.startDebug()
+	}
 	ship.pilot.Tick(ship.sim.tick)
+	for _, weapon := range ship.weapons {
+		weapon.defend()
+	}
 	for _, part := range ship.parts {
 		part.reset()
 	}
@@ -4,4 +4,6 @@ import (
 	_ "github.com/nathanielc/avi/dad"
 	_ "github.com/nathanielc/avi/jac"
 	_ "github.com/nathanielc/avi/nathanielc"
+	_ "github.com/nathanielc/avi/pilots"
+	_ "github.com/nathanielc/avi/wasm"
 )
@@ -13,31 +13,57 @@ import (
 	"github.com/golang/glog"
 )
 
-const minSectorSize = 100
 const SecondsPerTick = 1e-3
 const small = 1e-6
 
-const impulseToDamage = 0.25
-
 type Simulation struct {
-	ships      []*shipT
-	inrts      []Object
-	projs      []*projectile
-	ctlps      []*controlPoint
-	astds      []*asteroid
-	tick       int64
-	maxTicks   int64
-	radius     float64
-	sectorSize int64
+	ships []*shipT
+	inrts []Object
+	projs []*projectile
+	ctlps []*controlPoint
+	astds []*asteroid
+	zones []*zone
+	// Scan results for all zones, shared read only with all sensors.
+	zoneSRs []ZoneSR
+	flags   []*flagT
+	flagSRs []FlagSR
+	// Control points and zones defined by the map, in order, for events to target
+	mapCtlps []*controlPoint
+	mapZones []*zone
+	events   []*event
+	// Race checkpoints in order
+	checkpoints   []*checkpoint
+	checkpointSRs []CheckpointSR
+	// Attached objects keyed by their ID
+	attachments map[ID]*attachment
+	tick        int64
+	maxTicks    int64
+	sectorSize  int64
+	physics     physicsT
+	boundary    *boundary
+	projGrid    *projectileGrid
 	//Number of ships alive from each fleet
 	survivors map[string]int
 	scores    map[string]float64
 	maxScore  float64
+	mode      GameMode
+	// Starting point of each team
+	bases map[string]mgl64.Vec3
+	// Team of each fleet
+	teams map[string]string
+	// Damage multiplier between ships of the same team
+	friendlyFire float64
+	respawn      RespawnConf
+	respawns     []respawn
+	// Mass of respawned ships for each fleet
+	reinforcements map[string]float64
 	//Available parts
 	availableParts PartSetConf
 	//ID counter
 	idCounter ID
 	stream    Drawer
+	// Whether pilots record debug shapes
+	debug bool
 
 	added   map[ID]Drawable
 	deleted []ID
@@ -65,12 +91,50 @@ func NewSimulation(
 	correctedFPS := 1.0 / (float64(rate) * SecondsPerTick)
 	log.Println("correctedFPS", correctedFPS)
 	maxTicks := int64(float64(maxTime/time.Second) / float64(SecondsPerTick))
+	if err := mp.Rules.Physics.Validate(); err != nil {
+		return nil, err
+	}
+	if err := mp.Rules.Boundary.Validate(); err != nil {
+		return nil, err
+	}
+	boundaryConf, err := mp.Rules.boundaryConf()
+	if err != nil {
+		return nil, err
+	}
+	if err := parts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := mp.Rules.Respawn.Validate(); err != nil {
+		return nil, err
+	}
+	friendlyFire := 1.0
+	if mp.Rules.FriendlyFire != nil {
+		friendlyFire = *mp.Rules.FriendlyFire
+		if friendlyFire < 0 {
+			return nil, errors.New(fmt.Sprintf("friendly_fire must not be negative: %f", friendlyFire))
+		}
+	}
+	physics := mp.Rules.Physics.withDefaults()
+	mode, err := newGameMode(mp.Rules)
+	if err != nil {
+		return nil, err
+	}
 	sim := &Simulation{
-		radius:         float64(mp.Radius),
+		physics:        physics,
+		boundary:       newBoundary(boundaryConf, physics, float64(mp.Radius)),
+		projGrid:       newProjectileGrid(),
+		sectorSize:     physics.minSectorSize,
 		availableParts: parts,
 		survivors:      make(map[string]int),
 		scores:         make(map[string]float64),
 		maxScore:       mp.Rules.Score,
+		mode:           mode,
+		bases:          make(map[string]mgl64.Vec3),
+		teams:          make(map[string]string),
+		friendlyFire:   friendlyFire,
+		respawn:        mp.Rules.Respawn.withDefaults(),
+		reinforcements: make(map[string]float64),
+		attachments:    make(map[ID]*attachment),
 		rate:           rate,
 		maxTicks:       maxTicks,
 		stream:         stream,
@@ -79,13 +143,40 @@ func NewSimulation(
 	}
 	// Add Control Points
 	for _, cp := range mp.ControlPoints {
-		sim.addControlPoint(cp)
+		sim.mapCtlps = append(sim.mapCtlps, sim.addControlPoint(cp))
 	}
 	// Add Asteroids
 	for _, asteroid := range mp.Asteroids {
 		sim.addAsteroid(asteroid)
 	}
+	// Add Zones
+	for _, zone := range mp.Zones {
+		sim.mapZones = append(sim.mapZones, sim.addZone(zone))
+	}
+	// Add Events
+	for _, e := range mp.Events {
+		if err := e.Validate(); err != nil {
+			return nil, err
+		}
+		sim.events = append(sim.events, &event{conf: e})
+	}
+	// Add Checkpoints
+	for i, cp := range mp.Checkpoints {
+		if err := sim.addCheckpoint(i, cp); err != nil {
+			return nil, err
+		}
+	}
+	if mp.Rules.Mode == ModeRace && len(sim.checkpoints) == 0 {
+		return nil, errors.New("race maps need at least one checkpoint")
+	}
+	// Add Neutral Ships
+	for _, npc := range mp.NPCs {
+		if err := sim.addNPC(npc); err != nil {
+			return nil, err
+		}
+	}
 	// Add Fleets
+	teamSizes := make(map[string]int)
 	for i, fleet := range fleets {
 		if i == len(mp.StartingPoints) {
 			err := errors.New(fmt.Sprintf("Too many fleets for the map, only %d fleets allowed", len(mp.StartingPoints)))
@@ -95,12 +186,32 @@ func NewSimulation(
 		if err != nil {
 			return nil, err
 		}
+		team := fleet.Team
+		if team == "" {
+			team = fleet.Name
+		}
+		if fleet.Name == NeutralFleet || team == NeutralFleet {
+			return nil, errors.New(fmt.Sprintf("Fleet and team name '%s' is reserved", NeutralFleet))
+		}
+		teamSizes[team]++
+		if mp.Rules.TeamSize > 0 && teamSizes[team] > mp.Rules.TeamSize {
+			err := errors.New(fmt.Sprintf("Too many fleets on team '%s', only %d fleets allowed", team, mp.Rules.TeamSize))
+			return nil, err
+		}
+		sim.teams[fleet.Name] = team
+		if _, ok := sim.bases[team]; !ok {
+			sim.bases[team] = center
+		}
 		err = sim.addFleet(center, fleet, mp.Rules.MaxFleetMass)
 		if err != nil {
 			return nil, err
 		}
 
 	}
+	if s, ok := mode.(GameModeStarter); ok {
+		s.Start(sim)
+	}
+	sim.scanFlags()
 	return sim, nil
 }
 
@@ -119,43 +230,53 @@ func (sim *Simulation) AddShip(fleet string, pos mgl64.Vec3, pilot Pilot, conf S
 	if err != nil {
 		return nil, err
 	}
+	ship.team = sim.teamOf(fleet)
+	ship.lives = sim.respawn.Lives
+	ship.spawned = sim.tick
+	if sim.debug {
+		if d, ok := pilot.(debugPilot); ok {
+			d.enableDebug()
+		}
+	}
 	sim.ships = append(sim.ships, ship)
 	sim.added[ship.id] = ship
 
-	sim.survivors[fleet]++
+	sim.survivors[ship.team]++
 	return ship, nil
 }
+
+// Returns the team of the fleet, fleets not on a team are their own team.
+func (sim *Simulation) teamOf(fleet string) string {
+	if team, ok := sim.teams[fleet]; ok {
+		return team
+	}
+	return fleet
+}
+
 func (sim *Simulation) removeShip(i int) {
 
 }
 
-func (sim *Simulation) addProjectile(pos, vel mgl64.Vec3, mass, radius float64) {
-	p := &projectile{
-		objectT{
-			id:       sim.getNextID(),
-			position: pos,
-			velocity: vel,
-			mass:     mass,
-			radius:   radius,
-		},
-	}
+func (sim *Simulation) addProjectile(p *projectile) {
 	sim.mu.Lock()
+	p.id = sim.getNextID()
 	sim.projs = append(sim.projs, p)
 	sim.added[p.id] = p
 	sim.mu.Unlock()
 }
 
-func (sim *Simulation) addControlPoint(cpConf ControlPointConf) {
+func (sim *Simulation) addControlPoint(cpConf ControlPointConf) *controlPoint {
 
 	cp, err := NewControlPoint(sim.getNextID(), cpConf)
 	if err != nil {
 		glog.Error(err)
-		return
+		return nil
 	}
 
 	sim.inrts = append(sim.inrts, cp)
 	sim.ctlps = append(sim.ctlps, cp)
 	sim.added[cp.id] = cp
+	return cp
 }
 
 func (sim *Simulation) addAsteroid(aConf AsteroidConf) {
@@ -171,19 +292,66 @@ func (sim *Simulation) addAsteroid(aConf AsteroidConf) {
 	sim.added[as.id] = as
 }
 
+func (sim *Simulation) addZone(zConf ZoneConf) *zone {
+
+	z, err := NewZone(sim.getNextID(), zConf)
+	if err != nil {
+		glog.Error(err)
+		return nil
+	}
+
+	sim.zones = append(sim.zones, z)
+	sim.zoneSRs = append(sim.zoneSRs, z.scan())
+	sim.added[z.id] = z
+	return z
+}
+
+func (sim *Simulation) removeZone(z *zone) {
+	zones := sim.zones[0:0]
+	// Scan results are shared with sensors so build a new slice
+	srs := make([]ZoneSR, 0, len(sim.zoneSRs))
+	for _, zn := range sim.zones {
+		if zn == z {
+			sim.deleted = append(sim.deleted, z.id)
+			continue
+		}
+		zones = append(zones, zn)
+		srs = append(srs, zn.scan())
+	}
+	sim.zones = zones
+	sim.zoneSRs = srs
+}
+
+func (sim *Simulation) addCheckpoint(index int, cConf CheckpointConf) error {
+	c, err := NewCheckpoint(sim.getNextID(), index, cConf)
+	if err != nil {
+		return err
+	}
+	sim.checkpoints = append(sim.checkpoints, c)
+	sim.checkpointSRs = append(sim.checkpointSRs, c.scan())
+	sim.added[c.id] = c
+	return nil
+}
+
 // Adds a fleet to the imulation based on a given fleet config
 func (sim *Simulation) addFleet(center mgl64.Vec3, fleet FleetConf, maxMass float64) error {
 
 	fleetMass := 0.0
+	vips := 0
 
 	for _, shipConf := range fleet.Ships {
 
 		glog.Infof("Adding ship with pilot %s for fleet %s", shipConf.Pilot, fleet.Name)
-		pilot := getPilot(shipConf.Pilot)
-		if pilot == nil {
-			return errors.New(fmt.Sprintf("Unknown pilot '%s'", shipConf.Pilot))
+		if shipConf.VIP {
+			vips++
+			if vips > 1 {
+				return errors.New(fmt.Sprintf("Fleet '%s' has more than one VIP", fleet.Name))
+			}
+		}
+		pilot, err := newPilot(shipConf, fleet.Name, sim.teamOf(fleet.Name))
+		if err != nil {
+			return err
 		}
-		pilot.JoinFleet(fleet.Name)
 
 		relativePos, err := sliceToVec(shipConf.Position)
 		if err != nil {
@@ -199,6 +367,9 @@ func (sim *Simulation) addFleet(center mgl64.Vec3, fleet FleetConf, maxMass floa
 
 		fleetMass += ship.Mass()
 	}
+	if _, ok := sim.mode.(*vip); ok && vips == 0 {
+		return errors.New(fmt.Sprintf("Fleet '%s' has no VIP", fleet.Name))
+	}
 
 	if fleetMass > maxMass {
 		err := errors.New(fmt.Sprintf("Mass for fleet '%s' is too large '%f' > '%f'", fleet.Name, fleetMass, maxMass))
@@ -218,55 +389,36 @@ func (sim *Simulation) Start() {
 	}
 
 	c := sim.loop()
+	sim.Close()
 
 	glog.Infoln("All scores:", sim.scores)
 	glog.Infof("%s win with %f beacuse %s, @ tick: %d!!!", strings.Join(c.Winners, ", "), c.Score, c.Reason, sim.tick)
 }
 
+func closePilot(p Pilot) {
+	if c, ok := p.(Closer); ok {
+		c.Close()
+	}
+}
+
+// Close the pilots of all ships and ships waiting to respawn, once the game is over.
+func (sim *Simulation) Close() {
+	for _, ship := range sim.ships {
+		closePilot(ship.pilot)
+	}
+	for _, r := range sim.respawns {
+		closePilot(r.pilot)
+	}
+}
+
 type Condition struct {
 	// Winners reports the names of the winning fleets.
 	Winners []string
 	Score   float64
 	// Reason contains the reason for game end.
 	Reason string
-}
-
-func (sim *Simulation) checkEndConditions() (Condition, bool) {
-	bestFleets, score := sim.bestFleets()
-	end := false
-	var reason string
-	switch {
-	case sim.tick >= sim.maxTicks:
-		reason = "max ticks reached"
-		end = true
-	case len(sim.ships) == 0:
-		reason = "all ships have been destroyed"
-		end = true
-	case score > sim.maxScore:
-		reason = "max score reached"
-		end = true
-	default:
-		// Check if last survivor has best score
-		var numSurvivors int
-		var survivor string
-		for fleet, n := range sim.survivors {
-			if n > 0 {
-				numSurvivors++
-				survivor = fleet
-			}
-		}
-		if numSurvivors == 1 {
-			if len(bestFleets) == 1 && bestFleets[0] == survivor {
-				reason = "last surviving fleet has best score"
-				end = true
-			}
-		}
-	}
-	return Condition{
-		Winners: bestFleets,
-		Score:   score,
-		Reason:  reason,
-	}, end
+	// Results of the ships that finished a race, in finishing order.
+	Results []RaceResult
 }
 
 func (sim *Simulation) bestFleets() (bestFleets []string, bestScore float64) {
@@ -315,18 +467,36 @@ func (sim *Simulation) loop() Condition {
 					existing = append(existing, d)
 				}
 			}
+			for _, d := range sim.zones {
+				if _, ok := sim.added[d.id]; !ok {
+					existing = append(existing, d)
+				}
+			}
+			for _, d := range sim.checkpoints {
+				if _, ok := sim.added[d.id]; !ok {
+					existing = append(existing, d)
+				}
+			}
+			for _, d := range sim.flags {
+				if _, ok := sim.added[d.id]; !ok {
+					existing = append(existing, d)
+				}
+			}
 			// collect added
 			for id, d := range sim.added {
 				added = append(added, d)
 				delete(sim.added, id)
 			}
+			if d, ok := sim.stream.(DebugDrawer); ok {
+				d.DrawDebug(float64(sim.tick)*SecondsPerTick, sim.collectDebug())
+			}
 			sim.stream.Draw(float64(sim.tick)*SecondsPerTick, sim.scores, added, existing, sim.deleted)
 			sim.deleted = sim.deleted[0:0]
 			added = added[0:0]
 			existing = existing[0:0]
 		}
 		// Check game end conditions
-		if c, end := sim.checkEndConditions(); end {
+		if c, end := sim.mode.End(sim); end {
 			return c
 		}
 	}
@@ -334,31 +504,26 @@ func (sim *Simulation) loop() Condition {
 
 func (sim *Simulation) doTick() (float64, bool) {
 
-	score := sim.scoreFleets()
+	sim.mode.Score(sim)
+	sim.processEvents()
+	sim.projGrid.index(sim.projs, sim.sectorSize)
+	sim.applyZones()
+	for _, cp := range sim.ctlps {
+		cp.move(sim.tick)
+	}
 	sim.tickShips()
+	sim.deliverMessages()
 	sim.propagateObjects()
 	sim.collideObjects()
+	sim.boundShips()
 	sim.destroyShips()
+	sim.moveAttachments()
+	sim.scanFlags()
+	sim.respawnShips()
 	sim.tick++
+	_, score := sim.bestFleets()
 	return score, true
 }
-func (sim *Simulation) scoreFleets() float64 {
-	score := 0.0
-	for _, cp := range sim.ctlps {
-		influence2 := cp.influence * cp.influence
-		for _, ship := range sim.ships {
-			distance2 := LengthSq(cp.position.Sub(ship.position))
-			if distance2 < influence2 {
-				sim.scores[ship.fleet] += cp.points * SecondsPerTick
-			}
-			if s := sim.scores[ship.fleet]; s > score {
-				score = s
-			}
-		}
-	}
-	return score
-}
-
 func (sim *Simulation) tickShips() {
 	sim.shipWG.Add(len(sim.ships))
 	for _, ship := range sim.ships {
@@ -373,7 +538,7 @@ func (sim *Simulation) tickShips() {
 }
 
 func (sim *Simulation) propagateObjects() {
-	sim.sectorSize = minSectorSize
+	sim.sectorSize = sim.physics.minSectorSize
 	for _, ship := range sim.ships {
 		if glog.V(4) {
 			glog.Infoln("S: ",
@@ -394,6 +559,7 @@ func (sim *Simulation) propagateObjects() {
 		}
 	}
 	for _, proj := range sim.projs {
+		proj.applyDrag()
 		sim.propagateObject(proj)
 		if r := int64(proj.Radius() * 2); r > sim.sectorSize {
 			sim.sectorSize = r
@@ -413,23 +579,30 @@ func (sim *Simulation) propagateObject(obj Object) {
 
 func (sim *Simulation) collideObjects() {
 
-	const OO_COR = 0.7
-	const PO_COR = 0.1
+	ooCOR := sim.physics.objectCOR
+	poCOR := sim.physics.projectileCOR
+	damage := sim.physics.impulseToDamage
 
 	for _, ship0 := range sim.ships {
 		// Collide ships with ships
 		for _, ship1 := range sim.ships {
-			collide(ship0, ship1, OO_COR)
+			if collide(ship0, ship1, ooCOR, sim.damageBetween(ship0, ship1, damage)) {
+				sim.collided(ship0, ship1)
+			}
 		}
 		// Collide ships with interts
 		for _, inrt := range sim.inrts {
-			collide(ship0, inrt, OO_COR)
+			if collide(ship0, inrt, ooCOR, damage) {
+				sim.collided(ship0, inrt)
+			}
 		}
 	}
 	// Collide inerts with inerts
 	for _, i0 := range sim.inrts {
 		for _, i1 := range sim.inrts {
-			collide(i0, i1, OO_COR)
+			if collide(i0, i1, ooCOR, damage) {
+				sim.collided(i0, i1)
+			}
 		}
 	}
 	if glog.V(4) {
@@ -437,34 +610,98 @@ func (sim *Simulation) collideObjects() {
 	}
 
 	// Projectiles can only collide once
-	// So filter them out if they do
-	projs := sim.projs[0:0]
+	// So mark them dead if they do
 projectiles:
 	for _, p := range sim.projs {
+		if p.dead {
+			continue
+		}
 		// Collide projectiles with ships
 		for _, ship := range sim.ships {
-			if collide(p, ship, PO_COR) {
-				sim.deleted = append(sim.deleted, p.ID())
+			if collide(p, ship, poCOR, sim.damageBetween(p, ship, damage)) {
+				p.dead = true
+				sim.collided(p, ship)
 				continue projectiles
 			}
 		}
 		// Collide projectiles with inerts
 		for _, inrt := range sim.inrts {
-			if collide(p, inrt, PO_COR) {
-				sim.deleted = append(sim.deleted, p.ID())
+			if collide(p, inrt, poCOR, damage) {
+				p.dead = true
+				sim.collided(p, inrt)
 				continue projectiles
 			}
 		}
-		// Projectile didn't collide so keep it around, unless
-		// it left the play area.
-		if p.Position().Len() < sim.radius {
-			projs = append(projs, p)
+		// Collide projectiles with nearby enemy projectiles
+		sim.projGrid.near(p.position, float64(sim.sectorSize), func(q *projectile) {
+			if p.team != "" && p.team == q.team {
+				return
+			}
+			if !p.dead && collide(p, q, poCOR, sim.damageBetween(p, q, damage)) {
+				p.dead = true
+				q.dead = true
+				sim.collided(p, q)
+			}
+		})
+	}
+
+	// Filter out dead and expired projectiles and
+	// projectiles that left the play area.
+	projs := sim.projs[0:0]
+	for _, p := range sim.projs {
+		if p.dead || p.expired(sim.tick) || !sim.boundProjectile(p) {
+			sim.deleted = append(sim.deleted, p.ID())
+			continue
 		}
+		projs = append(projs, p)
 	}
 	sim.projs = projs
 }
 
-func collide(obj1, obj2 Object, cor float64) bool {
+// Returns the impulse to damage factor for a collision, scaled by the friendly fire rule.
+func (sim *Simulation) damageBetween(obj1, obj2 Object, impulseToDamage float64) float64 {
+	if team := teamOf(obj1); team != "" && team == teamOf(obj2) {
+		return impulseToDamage * sim.friendlyFire
+	}
+	return impulseToDamage
+}
+
+// Record which team damaged each ship and notify the game mode of the collision.
+func (sim *Simulation) collided(obj1, obj2 Object) {
+	attack(obj1, obj2)
+	attack(obj2, obj1)
+	sim.mode.Collided(sim, obj1, obj2)
+}
+
+func attack(victim, attacker Object) {
+	ship, ok := victim.(*shipT)
+	if !ok {
+		return
+	}
+	team := teamOf(attacker)
+	if team == "" || team == ship.team {
+		return
+	}
+	if p, ok := attacker.(*projectile); ok && p.shooter != nil {
+		p.shooter.hits++
+	}
+	if team != NeutralFleet {
+		ship.lastAttacker = team
+	}
+}
+
+// Returns the team of a ship or projectile, empty for other objects.
+func teamOf(obj Object) string {
+	switch o := obj.(type) {
+	case *shipT:
+		return o.team
+	case *projectile:
+		return o.team
+	}
+	return ""
+}
+
+func collide(obj1, obj2 Object, cor, impulseToDamage float64) bool {
 	if obj1 == obj2 {
 		return false
 	}
@@ -473,6 +710,10 @@ func collide(obj1, obj2 Object, cor float64) bool {
 	dynamicPos := obj1.Position()
 	dynamicVel := obj1.Velocity().Sub(obj2.Velocity()).Mul(SecondsPerTick)
 	maxRange := dynamicVel.Len()
+	// Not moving relative to each other, the direction of travel is undefined
+	if maxRange < small {
+		return false
+	}
 
 	delta := staticPos.Sub(dynamicPos)
 	distance := delta.Len()
@@ -484,7 +725,7 @@ func collide(obj1, obj2 Object, cor float64) bool {
 		return false
 		//} else if distanceRadii < 0 {
 		//	//We have a static collision
-		//	resolveCollision(obj1, obj2, cor)
+		//	resolveCollision(obj1, obj2, cor, impulseToDamage)
 		//	return true
 	}
 
@@ -529,12 +770,12 @@ func collide(obj1, obj2 Object, cor float64) bool {
 	obj2.setPosition(obj2.Position().Add(v2))
 
 	//Resolve collision
-	resolveCollision(obj1, obj2, cor)
+	resolveCollision(obj1, obj2, cor, impulseToDamage)
 
 	return true
 }
 
-func resolveCollision(obj1, obj2 Object, cor float64) {
+func resolveCollision(obj1, obj2 Object, cor, impulseToDamage float64) {
 	norm := obj1.Position().Sub(obj2.Position()).Normalize()
 
 	// inverse mass
@@ -564,9 +805,20 @@ func resolveCollision(obj1, obj2 Object, cor float64) {
 func (sim *Simulation) destroyShips() {
 	ships := sim.ships[0:0]
 	for _, ship := range sim.ships {
-		if ship.Health() <= 0 || ship.Position().Len() > sim.radius {
+		if ship.Health() <= 0 || sim.outOfBounds(ship) {
 			sim.deleted = append(sim.deleted, ship.ID())
-			sim.survivors[ship.fleet]--
+			sim.detachAll(ship)
+			if ship.npc {
+				closePilot(ship.pilot)
+				continue
+			}
+			sim.survivors[ship.team]--
+			sim.mode.Killed(sim, ship.id, ship.team, ship.lastAttacker)
+			respawning := sim.queueRespawn(ship)
+			// Respawner pilots fly the respawned ship
+			if _, reused := ship.pilot.(Respawner); !reused || !respawning {
+				closePilot(ship.pilot)
+			}
 		} else {
 			ships = append(ships, ship)
 		}
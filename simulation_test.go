@@ -3,8 +3,10 @@ package avi
 import (
 	"flag"
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/go-gl/mathgl/mgl64"
 	"github.com/stretchr/testify/assert"
@@ -37,7 +39,7 @@ func TestShouldCollideStaticObjects(t *testing.T) {
 		radius:   10,
 	}
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.True(collision)
 }
 
@@ -58,7 +60,7 @@ func TestShouldNotCollideStaticObjects(t *testing.T) {
 		radius:   10,
 	}
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.False(collision)
 }
 
@@ -82,7 +84,7 @@ func TestShouldCollideStaticDynamicObjects(t *testing.T) {
 
 	v2 := obj2.velocity.Len()
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.True(collision)
 	assert.Equal(v2, obj1.velocity.Len())
 	assert.Equal(0.0, obj2.velocity.Len())
@@ -106,7 +108,7 @@ func TestShouldNotCollideStaticDynamicObjects(t *testing.T) {
 		radius:   10,
 	}
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.False(collision)
 }
 
@@ -129,7 +131,7 @@ func TestShouldCollideParallelDynamicObjects(t *testing.T) {
 		radius:   10,
 	}
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.True(collision)
 }
 
@@ -154,7 +156,7 @@ func TestCollisionShouldDoDamage(t *testing.T) {
 		health:   health,
 	}
 
-	collision := collide(obj1, obj2, 0.2)
+	collision := collide(obj1, obj2, 0.2, defaultImpulseToDamage)
 	assert.True(collision)
 	assert.True(health > obj1.health, fmt.Sprint(obj1.health))
 	assert.True(health > obj2.health, fmt.Sprint(obj2.health))
@@ -181,7 +183,7 @@ func TestElasticCollisionShouldNotDoDamage(t *testing.T) {
 		health:   health,
 	}
 
-	collision := collide(obj1, obj2, 1.0)
+	collision := collide(obj1, obj2, 1.0, defaultImpulseToDamage)
 	assert.True(collision)
 	assert.InDelta(health, obj1.health, 1e-5)
 	assert.InDelta(health, obj2.health, 1e-5)
@@ -218,7 +220,7 @@ func BenchmarkTick(b *testing.B) {
 			r.Float64() * maxVel,
 			r.Float64() * maxVel,
 		}
-		sim.addProjectile(pos, vel, 1, 0.1)
+		sim.addProjectile(newProjectile(pos, vel, 1, 0.1))
 	}
 
 	b.ReportAllocs()
@@ -267,3 +269,1726 @@ func (self *oneDirPilot) LinkParts(shipParts []ShipPartConf, availableParts Part
 		self.weapon,
 	}, nil
 }
+
+func TestPhysicsConfDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	cor := 0.9
+	c := PhysicsConf{ObjectCOR: &cor}.withDefaults()
+	assert.Equal(0.9, c.objectCOR)
+	assert.Equal(defaultProjectileCOR, c.projectileCOR)
+	assert.Equal(defaultImpulseToDamage, c.impulseToDamage)
+	assert.Equal(int64(defaultMinSectorSize), c.minSectorSize)
+
+	// Explicit zeros are honoured
+	zero := 0.0
+	c = PhysicsConf{ImpulseToDamage: &zero, ObjectCOR: &zero, ProjectileCOR: &zero}.withDefaults()
+	assert.Equal(0.0, c.impulseToDamage)
+	assert.Equal(0.0, c.objectCOR)
+	assert.Equal(0.0, c.projectileCOR)
+}
+
+func TestPhysicsConfValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	high, negative := 1.5, -0.1
+	assert.Nil(PhysicsConf{}.Validate())
+	assert.NotNil(PhysicsConf{ObjectCOR: &high}.Validate())
+	assert.NotNil(PhysicsConf{ProjectileCOR: &negative}.Validate())
+	assert.NotNil(PhysicsConf{ImpulseToDamage: &negative}.Validate())
+	assert.NotNil(BoundaryConf{Mode: "teleport"}.Validate())
+	assert.NotNil(BoundaryConf{ShrinkRate: -1}.Validate())
+	assert.NotNil(BoundaryConf{COR: &high}.Validate())
+	assert.NotNil(BoundaryConf{Damage: &negative}.Validate())
+}
+
+func TestImpulseToDamageScalesDamage(t *testing.T) {
+	assert := assert.New(t)
+
+	newPair := func() (*objectT, *objectT) {
+		return &objectT{
+			position: mgl64.Vec3{0, 0, 0},
+			mass:     1000,
+			radius:   10,
+			health:   10,
+		}, &objectT{
+			position: mgl64.Vec3{21, 0, 0},
+			velocity: mgl64.Vec3{-2 * 1 / SecondsPerTick, 0, 0},
+			mass:     1000,
+			radius:   10,
+			health:   10,
+		}
+	}
+
+	a1, a2 := newPair()
+	b1, b2 := newPair()
+	assert.True(collide(a1, a2, 0.2, 1))
+	assert.True(collide(b1, b2, 0.2, 2))
+	assert.InDelta(2*(10-a1.health), 10-b1.health, 1e-5)
+	assert.InDelta(2*(10-a2.health), 10-b2.health, 1e-5)
+}
+
+func newBoundaryTestSim(t *testing.T, conf BoundaryConf) *Simulation {
+	return newTestSim(t, MapConf{
+		Radius: 100,
+		Rules: RulesConf{
+			Boundary: conf,
+		},
+	})
+}
+
+func newTestSim(t *testing.T, mp MapConf) *Simulation {
+	sim, err := NewSimulation(
+		mp,
+		PartSetConf{},
+		nil,
+		nil,
+		time.Second,
+		60,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+func TestBoundaryDestroyAndIgnore(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, mode := range []string{BoundaryDestroy, BoundaryIgnore} {
+		sim := newBoundaryTestSim(t, BoundaryConf{Mode: mode})
+		ship, err := sim.AddShip("f1", mgl64.Vec3{200, 0, 0}, NewDud(), ShipConf{})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.health = 1
+		sim.boundShips()
+		sim.destroyShips()
+		assert.Equal(mode == BoundaryIgnore, len(sim.ships) == 1, mode)
+	}
+}
+
+func TestBoundaryWall(t *testing.T) {
+	assert := assert.New(t)
+
+	cor := 0.5
+	sim := newBoundaryTestSim(t, BoundaryConf{Mode: BoundaryWall, COR: &cor})
+	ship, err := sim.AddShip("f1", mgl64.Vec3{101, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.mass = 10
+	ship.health = 1e6
+	ship.velocity = mgl64.Vec3{10, 5, 0}
+	sim.boundShips()
+	sim.destroyShips()
+
+	assert.Equal(1, len(sim.ships))
+	assert.InDelta(100, ship.position.Len(), 1e-6)
+	assert.InDelta(-5, ship.velocity.X(), 1e-6)
+	assert.InDelta(5, ship.velocity.Y(), 1e-6)
+	assert.True(ship.health < 1e6)
+
+	// An explicit zero makes the wall fully inelastic
+	cor = 0
+	sim = newBoundaryTestSim(t, BoundaryConf{Mode: BoundaryWall, COR: &cor})
+	assert.Equal(0.0, sim.boundary.cor)
+	ship, err = sim.AddShip("f1", mgl64.Vec3{101, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.mass = 10
+	ship.health = 1e6
+	ship.velocity = mgl64.Vec3{10, 5, 0}
+	sim.boundShips()
+	assert.InDelta(0, ship.velocity.X(), 1e-6)
+	assert.InDelta(5, ship.velocity.Y(), 1e-6)
+
+	// Unset uses the physics object_cor
+	sim = newBoundaryTestSim(t, BoundaryConf{Mode: BoundaryWall})
+	assert.Equal(defaultObjectCOR, sim.boundary.cor)
+}
+
+func TestBoundaryWrap(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newBoundaryTestSim(t, BoundaryConf{Mode: BoundaryWrap})
+	ship, err := sim.AddShip("f1", mgl64.Vec3{0, 101, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 1
+	sim.boundShips()
+	sim.destroyShips()
+
+	assert.Equal(1, len(sim.ships))
+	assert.True(ship.position.Y() < -99, ship.position)
+
+	// Projectiles are destroyed rather than wrapped so their range still holds
+	p := newProjectile(mgl64.Vec3{0, 0, 150}, mgl64.Vec3{}, 1, 1)
+	assert.False(sim.boundProjectile(p))
+	assert.True(sim.boundProjectile(newProjectile(mgl64.Vec3{0, 0, 50}, mgl64.Vec3{}, 1, 1)))
+}
+
+func TestBoundaryOutOfBounds(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 100,
+		Rules: RulesConf{
+			Physics: PhysicsConf{OutOfBounds: BoundaryIgnore},
+		},
+	})
+	assert.Equal(BoundaryIgnore, sim.boundary.conf.Mode)
+
+	assert.NotNil(PhysicsConf{OutOfBounds: "teleport"}.Validate())
+	_, err := NewSimulation(MapConf{
+		Rules: RulesConf{
+			Physics:  PhysicsConf{OutOfBounds: BoundaryIgnore},
+			Boundary: BoundaryConf{Mode: BoundaryWall},
+		},
+	}, PartSetConf{}, nil, nil, time.Second, 60)
+	assert.NotNil(err)
+}
+
+func TestBoundaryShrink(t *testing.T) {
+	assert := assert.New(t)
+
+	damage := 1000.0
+	sim := newBoundaryTestSim(t, BoundaryConf{
+		Mode:        BoundaryShrink,
+		ShrinkStart: 1,
+		ShrinkRate:  10,
+		MinRadius:   50,
+		Damage:      &damage,
+	})
+	ship, err := sim.AddShip("f1", mgl64.Vec3{90, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 10
+
+	sim.tick = int64(0.5 / SecondsPerTick)
+	sim.boundShips()
+	assert.Equal(100.0, sim.boundary.radius)
+	assert.Equal(10.0, ship.health)
+	assert.Equal(0.0, sim.boundary.scan(sim.tick).ShrinkRate)
+
+	sim.tick = int64(2 / SecondsPerTick)
+	sim.boundShips()
+	assert.InDelta(90, sim.boundary.radius, 1e-6)
+	assert.Equal(10.0, sim.boundary.scan(sim.tick).ShrinkRate)
+
+	sim.tick = int64(3 / SecondsPerTick)
+	sim.boundShips()
+	assert.InDelta(80, sim.boundary.radius, 1e-6)
+	assert.InDelta(9, ship.health, 1e-6)
+
+	sim.tick = int64(60 / SecondsPerTick)
+	sim.boundShips()
+	sr := sim.boundary.scan(sim.tick)
+	assert.Equal(50.0, sr.Radius)
+	assert.Equal(50.0, sr.MinRadius)
+	assert.Equal(0.0, sr.ShrinkRate)
+
+	// An explicit zero shrinks without damage
+	damage = 0
+	sim = newBoundaryTestSim(t, BoundaryConf{Mode: BoundaryShrink, ShrinkRate: 10, Damage: &damage})
+	ship, err = sim.AddShip("f1", mgl64.Vec3{90, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 10
+	sim.tick = int64(2 / SecondsPerTick)
+	sim.boundShips()
+	assert.Equal(10.0, ship.health)
+	assert.Equal(float64(defaultBoundaryDamage), newBoundaryTestSim(t, BoundaryConf{}).boundary.damage)
+}
+
+func TestProjectilesCollideWithProjectiles(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newBoundaryTestSim(t, BoundaryConf{})
+	p := newProjectile(mgl64.Vec3{-2, 0, 0}, mgl64.Vec3{1 / SecondsPerTick, 0, 0}, 1, 0.5)
+	q := newProjectile(mgl64.Vec3{2, 0, 0}, mgl64.Vec3{-1 / SecondsPerTick, 0, 0}, 1, 0.5)
+	r := newProjectile(mgl64.Vec3{50, 0, 0}, mgl64.Vec3{}, 1, 0.5)
+	sim.addProjectile(p)
+	sim.addProjectile(q)
+	sim.addProjectile(r)
+
+	sim.doTick()
+
+	assert.True(p.dead)
+	assert.True(q.dead)
+	assert.False(r.dead)
+	assert.Equal(1, len(sim.projs))
+	assert.Contains(sim.deleted, p.ID())
+	assert.Contains(sim.deleted, q.ID())
+
+	// Rounds of the same team pass through each other
+	sim = newBoundaryTestSim(t, BoundaryConf{})
+	p = newProjectile(mgl64.Vec3{-2, 0, 0}, mgl64.Vec3{1 / SecondsPerTick, 0, 0}, 1, 0.5)
+	q = newProjectile(mgl64.Vec3{2, 0, 0}, mgl64.Vec3{-1 / SecondsPerTick, 0, 0}, 1, 0.5)
+	p.team, q.team = "t1", "t1"
+	sim.addProjectile(p)
+	sim.addProjectile(q)
+	sim.doTick()
+	assert.False(p.dead)
+	assert.False(q.dead)
+
+	// Overlapping rounds with the same velocity do not collide
+	v := mgl64.Vec3{10, 0, 0}
+	p = newProjectile(mgl64.Vec3{0, 0, 0}, v, 1, 0.5)
+	q = newProjectile(mgl64.Vec3{0.5, 0, 0}, v, 1, 0.5)
+	assert.False(collide(p, q, 1, 1))
+	assert.Equal(v, p.Velocity())
+	assert.Equal(mgl64.Vec3{}, p.Position())
+}
+
+func TestProjectileGridNear(t *testing.T) {
+	assert := assert.New(t)
+
+	g := newProjectileGrid()
+	near := newProjectile(mgl64.Vec3{5, 5, 5}, mgl64.Vec3{}, 1, 1)
+	far := newProjectile(mgl64.Vec3{500, 5, 5}, mgl64.Vec3{}, 1, 1)
+	neg := newProjectile(mgl64.Vec3{-5, -5, -5}, mgl64.Vec3{}, 1, 1)
+	g.index([]*projectile{near, far, neg}, 10)
+
+	var found []*projectile
+	g.near(mgl64.Vec3{0, 0, 0}, 10, func(p *projectile) {
+		found = append(found, p)
+	})
+	assert.Equal(2, len(found))
+	assert.Contains(found, near)
+	assert.Contains(found, neg)
+}
+
+func TestInterceptTime(t *testing.T) {
+	assert := assert.New(t)
+
+	// Head on target
+	assert.InDelta(1, InterceptTime(mgl64.Vec3{200, 0, 0}, mgl64.Vec3{-100, 0, 0}, 100), 1e-9)
+	// Crossing target
+	deltaPos := mgl64.Vec3{100, 0, 0}
+	deltaVel := mgl64.Vec3{0, 50, 0}
+	tm := InterceptTime(deltaPos, deltaVel, 100)
+	hit := deltaPos.Add(deltaVel.Mul(tm))
+	assert.InDelta(100*tm, hit.Len(), 1e-9)
+	// Target is faster and moving away
+	assert.Equal(-1.0, InterceptTime(mgl64.Vec3{100, 0, 0}, mgl64.Vec3{200, 0, 0}, 100))
+}
+
+func TestPointDefenceInterceptsProjectile(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1000})
+	ship, err := sim.AddShip("defender", mgl64.Vec3{}, &pointDefencePilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	health := ship.health
+	threat := newProjectile(mgl64.Vec3{300, 10, 0}, mgl64.Vec3{-100, -3, 0}, 1, 0.5)
+	threat.team = "attacker"
+	friendly := newProjectile(mgl64.Vec3{0, 100, 0}, mgl64.Vec3{0, -10, 0}, 1, 0.5)
+	friendly.team = "defender"
+	sim.addProjectile(threat)
+	sim.addProjectile(friendly)
+
+	for i := 0; i < 3000 && !threat.dead; i++ {
+		sim.doTick()
+	}
+	assert.True(threat.dead)
+	assert.False(friendly.dead)
+	assert.Equal(health, ship.health)
+}
+
+type pointDefencePilot struct {
+	GenericPilot
+}
+
+func (self *pointDefencePilot) LinkParts(shipParts []ShipPartConf, availableParts PartSetConf) ([]Part, error) {
+	self.Engines = []*Engine{NewEngine001(mgl64.Vec3{0, 0, 0})}
+	self.Weapons = []*Weapon{NewWeaponFromConf(mgl64.Vec3{7, 0, 0}, WeaponConf{
+		Mass:          10,
+		Radius:        1,
+		Energy:        1,
+		AmmoVelocity:  500,
+		AmmoMass:      0.1,
+		AmmoRadius:    0.5,
+		AmmoCapacity:  100,
+		Cooldown:      0.05,
+		PointDefence:  true,
+		DefenceRadius: 150,
+	})}
+	return []Part{self.Engines[0], self.Weapons[0]}, nil
+}
+
+func (self *pointDefencePilot) Tick(tick int64) {
+	self.Engines[0].PowerOn(1)
+}
+
+func TestProjectileLifetimeRangeAndDrag(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1e6})
+	fire := func(conf WeaponConf) *projectile {
+		ship, err := sim.AddShip("f1", mgl64.Vec3{0, 0, 1e3 * float64(len(sim.ships))}, NewDud(), ShipConf{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := NewWeaponFromConf(mgl64.Vec3{}, conf)
+		w.setShip(ship)
+		if err := w.Fire(mgl64.Vec3{1, 0, 0}); err != nil {
+			t.Fatal(err)
+		}
+		return sim.projs[len(sim.projs)-1]
+	}
+	conf := WeaponConf{AmmoVelocity: 100, AmmoMass: 1, AmmoCapacity: 1}
+
+	lifetime := conf
+	lifetime.Lifetime = 0.5
+	pl := fire(lifetime)
+
+	ranged := conf
+	ranged.Range = 20
+	pr := fire(ranged)
+
+	drag := conf
+	drag.Drag = 10
+	pd := fire(drag)
+
+	forever := fire(conf)
+
+	for i := 0; i < 1000; i++ {
+		sim.doTick()
+		if i == 100 {
+			assert.True(pd.velocity.Len() < 100*math.Exp(-0.9), pd.velocity.Len())
+		}
+	}
+	assert.Equal(1, len(sim.projs))
+	assert.Equal(forever, sim.projs[0])
+	assert.Contains(sim.deleted, pl.ID())
+	assert.Contains(sim.deleted, pr.ID())
+	assert.Contains(sim.deleted, pd.ID())
+	assert.InDelta(20, pr.position.Sub(pr.origin).Len(), 1)
+	assert.Equal(lifetime.Lifetime, NewWeaponFromConf(mgl64.Vec3{}, lifetime).GetLifetime())
+}
+
+func TestWeaponConfValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(WeaponConf{}.Validate())
+	assert.Nil(WeaponConf{PointDefence: true, DefenceRadius: 10}.Validate())
+	assert.NotNil(WeaponConf{PointDefence: true}.Validate())
+	assert.NotNil(WeaponConf{PointDefence: true, DefenceRadius: -1}.Validate())
+	assert.NotNil(WeaponConf{Range: -1}.Validate())
+	assert.NotNil(WeaponConf{Lifetime: -1}.Validate())
+	assert.NotNil(WeaponConf{Drag: -1}.Validate())
+
+	parts := PartSetConf{Weapons: map[string]WeaponConf{"pd": {PointDefence: true}}}
+	_, err := NewSimulation(MapConf{}, parts, nil, nil, time.Second, 60)
+	assert.NotNil(err)
+}
+
+func TestZoneContains(t *testing.T) {
+	assert := assert.New(t)
+
+	sphere, err := NewZone(0, ZoneConf{Position: []float64{10, 0, 0}, Radius: 5})
+	if !assert.Nil(err) {
+		return
+	}
+	assert.True(sphere.contains(mgl64.Vec3{14, 0, 0}))
+	assert.False(sphere.contains(mgl64.Vec3{10, 6, 0}))
+
+	box, err := NewZone(1, ZoneConf{Shape: ZoneBox, Position: []float64{0, 0, 0}, Size: []float64{10, 2, 2}})
+	if !assert.Nil(err) {
+		return
+	}
+	assert.True(box.contains(mgl64.Vec3{4.9, 0.9, -0.9}))
+	assert.False(box.contains(mgl64.Vec3{0, 1.1, 0}))
+	assert.Equal(mgl64.Vec3{10, 2, 2}, box.Size())
+
+	_, err = NewZone(2, ZoneConf{Shape: "torus", Position: []float64{0, 0, 0}, Radius: 1})
+	assert.NotNil(err)
+	_, err = NewZone(2, ZoneConf{Position: []float64{0, 0, 0}, Radius: 1, SensorDampening: 2})
+	assert.NotNil(err)
+}
+
+func TestZoneEffects(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1e4,
+		Zones: []ZoneConf{
+			{
+				Position:        []float64{0, 0, 0},
+				Radius:          100,
+				Drag:            1,
+				Damage:          1000,
+				EnergyDrain:     0.5,
+				SensorDampening: 1,
+			},
+		},
+	})
+	inside, err := sim.AddShip("f1", mgl64.Vec3{}, &sensorPilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	outside, err := sim.AddShip("f2", mgl64.Vec3{500, 0, 0}, &sensorPilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	inside.velocity = mgl64.Vec3{10, 0, 0}
+	health := inside.health
+
+	// Engines power up on the first tick and the first scan is only available on the third
+	for i := 0; i < 3; i++ {
+		sim.doTick()
+	}
+
+	assert.True(inside.velocity.X() < 10)
+	assert.InDelta(health-3, inside.health, 1e-6)
+	assert.InDelta(inside.engines[0].energy/2, inside.totalEnergy, 1e-6)
+	assert.Equal(outside.engines[0].energy, outside.totalEnergy)
+
+	// The ship inside the zone can neither see nor be seen
+	scan := outside.pilot.(*sensorPilot).scan
+	assert.Equal(0, len(scan.Ships))
+	assert.Equal(1, len(scan.Zones))
+	assert.Equal(ZoneSphere, scan.Zones[0].Shape)
+}
+
+type sensorPilot struct {
+	GenericPilot
+	scan ScanResult
+}
+
+func (self *sensorPilot) LinkParts(shipParts []ShipPartConf, availableParts PartSetConf) ([]Part, error) {
+	self.Engines = []*Engine{NewEngine001(mgl64.Vec3{0, 0, 0})}
+	self.Sensors = []*Sensor{NewSensor001(mgl64.Vec3{7, 0, 0})}
+	return []Part{self.Engines[0], self.Sensors[0]}, nil
+}
+
+func (self *sensorPilot) Tick(tick int64) {
+	self.Engines[0].PowerOn(1)
+	if scan, err := self.Sensors[0].Scan(); err == nil {
+		self.scan = scan
+	}
+}
+
+func TestPathMover(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := newPathMover(mgl64.Vec3{0, 0, 0}, PathConf{
+		Waypoints: [][]float64{{10, 0, 0}, {10, 10, 0}},
+		Speed:     2,
+		Loop:      true,
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(mgl64.Vec3{4, 0, 0}, m.position(2))
+	assert.Equal(mgl64.Vec3{10, 2, 0}, m.position(6))
+	// Returning to the start along the diagonal
+	p := m.position(10 + math.Sqrt(200)/4)
+	assert.InDelta(5, p.X(), 1e-9)
+	assert.InDelta(5, p.Y(), 1e-9)
+	// Looped back to the beginning
+	p = m.position((20+math.Sqrt(200))/2 + 1)
+	assert.InDelta(2, p.X(), 1e-9)
+	assert.InDelta(0, p.Y(), 1e-9)
+
+	m, err = newPathMover(mgl64.Vec3{0, 0, 0}, PathConf{
+		Waypoints: [][]float64{{10, 0, 0}},
+		Speed:     1,
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(mgl64.Vec3{10, 0, 0}, m.position(100))
+
+	_, err = newPathMover(mgl64.Vec3{}, PathConf{Waypoints: [][]float64{{1, 0, 0}}})
+	assert.NotNil(err)
+}
+
+func TestOrbitingControlPoint(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1e4,
+		ControlPoints: []ControlPointConf{
+			{
+				Mass:     1e6,
+				Radius:   10,
+				Position: []float64{100, 0, 0},
+				Orbit: OrbitConf{
+					Center: []float64{0, 0, 0},
+					Period: 4,
+				},
+			},
+		},
+	})
+	cp := sim.ctlps[0]
+	for i := 0; i < 1000; i++ {
+		sim.doTick()
+	}
+	// A quarter orbit
+	assert.InDelta(0, cp.position.X(), 1e-6)
+	assert.InDelta(100, cp.position.Y(), 1e-6)
+	// Tangential speed of the orbit
+	assert.InDelta(2*math.Pi*100/4, cp.velocity.Len(), 0.1)
+}
+
+func TestControlPointConfMotion(t *testing.T) {
+	assert := assert.New(t)
+
+	cp, err := NewControlPoint(0, ControlPointConf{
+		Position: []float64{0, 0, 0},
+		Velocity: []float64{1, 2, 3},
+	})
+	assert.Nil(err)
+	assert.Equal(mgl64.Vec3{1, 2, 3}, cp.velocity)
+	assert.Nil(cp.mover)
+
+	_, err = NewControlPoint(0, ControlPointConf{
+		Position: []float64{0, 0, 0},
+		Path:     PathConf{Waypoints: [][]float64{{1, 0, 0}}, Speed: 1},
+		Orbit:    OrbitConf{Center: []float64{0, 0, 0}, Period: 1},
+	})
+	assert.NotNil(err)
+}
+
+func TestControlPointCapture(t *testing.T) {
+	assert := assert.New(t)
+
+	cp, err := NewControlPoint(0, ControlPointConf{
+		Position:    []float64{0, 0, 0},
+		CaptureTime: 4 * SecondsPerTick,
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	for i := 0; i < 4; i++ {
+		cp.capture([]string{"red"})
+	}
+	assert.Equal("red", cp.owner)
+	assert.Equal(1.0, cp.progress)
+
+	// Contested points make no progress
+	cp.capture([]string{"red", "blue"})
+	assert.True(cp.contested)
+	assert.Equal(1.0, cp.progress)
+
+	// Blue must first undo red's progress
+	for i := 0; i < 4; i++ {
+		cp.capture([]string{"blue"})
+	}
+	assert.False(cp.contested)
+	assert.Equal("", cp.owner)
+	assert.Equal("blue", cp.capturer)
+	assert.InDelta(0, cp.progress, 1e-9)
+	for i := 0; i < 4; i++ {
+		cp.capture([]string{"blue"})
+	}
+	assert.Equal("blue", cp.owner)
+
+	// Nobody present keeps the current state
+	cp.capture(nil)
+	assert.Equal("blue", cp.owner)
+	assert.Equal(1.0, cp.progress)
+}
+
+func TestScoreFleetsOnlyScoresOwner(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1e4,
+		ControlPoints: []ControlPointConf{
+			{
+				Mass:      1e6,
+				Radius:    10,
+				Position:  []float64{0, 0, 0},
+				Points:    1000,
+				Influence: 100,
+			},
+		},
+	})
+	for i := 0; i < 3; i++ {
+		_, err := sim.AddShip("red", mgl64.Vec3{50, float64(i * 20), 0}, NewDud(), ShipConf{})
+		assert.Nil(err)
+	}
+	blue, err := sim.AddShip("blue", mgl64.Vec3{500, 0, 0}, NewDud(), ShipConf{})
+	assert.Nil(err)
+
+	sim.mode.Score(sim)
+	// Stacking ships is not rewarded
+	assert.InDelta(1, sim.scores["red"], 1e-9)
+	assert.Equal("red", sim.ctlps[0].owner)
+
+	blue.position = mgl64.Vec3{-50, 0, 0}
+	sim.mode.Score(sim)
+	assert.True(sim.ctlps[0].contested)
+	assert.InDelta(1, sim.scores["red"], 1e-9)
+	assert.Equal(0.0, sim.scores["blue"])
+}
+
+func TestUnknownGameMode(t *testing.T) {
+	_, err := NewSimulation(
+		MapConf{Rules: RulesConf{Mode: "bogus"}},
+		PartSetConf{},
+		nil,
+		nil,
+		time.Second,
+		60,
+	)
+	assert.NotNil(t, err)
+}
+
+func TestDeathmatchScoresKills(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Mode: ModeDeathmatch, Score: 10, KillPoints: 2},
+	})
+	for _, fleet := range []string{"f1", "f1", "f2"} {
+		if _, err := sim.AddShip(fleet, mgl64.Vec3{}, NewDud(), ShipConf{}); !assert.Nil(err) {
+			return
+		}
+	}
+	sim.ships[2].lastAttacker = "f1"
+	sim.ships[2].health = 0
+	sim.destroyShips()
+
+	assert.Equal(2.0, sim.scores["f1"])
+	c, end := sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"f1"}, c.Winners)
+}
+
+func TestLastFleetStandingScoresSurvivors(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Mode: ModeLastFleetStanding},
+	})
+	for _, fleet := range []string{"f1", "f2", "f2"} {
+		if _, err := sim.AddShip(fleet, mgl64.Vec3{}, NewDud(), ShipConf{}); !assert.Nil(err) {
+			return
+		}
+	}
+	sim.mode.Score(sim)
+	assert.Equal(1.0, sim.scores["f1"])
+	assert.Equal(2.0, sim.scores["f2"])
+	_, end := sim.mode.End(sim)
+	assert.False(end)
+
+	sim.ships[0].health = 0
+	sim.destroyShips()
+	c, end := sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"f2"}, c.Winners)
+}
+
+func TestCaptureTheFlag(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Mode: ModeCaptureTheFlag, CTF: CTFConf{BaseRadius: 10}},
+	})
+	sim.bases["f1"] = mgl64.Vec3{-100, 0, 0}
+	sim.bases["f2"] = mgl64.Vec3{100, 0, 0}
+	ctf := sim.mode.(*captureTheFlag)
+	ctf.Start(sim)
+	if !assert.Len(sim.flags, 2) {
+		return
+	}
+	flag := ctf.flags["f2"]
+
+	carrier, err := sim.AddShip("f1", mgl64.Vec3{100, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	mass := carrier.mass
+
+	// Touching the enemy flag picks it up
+	sim.mode.Score(sim)
+	parent, ok := sim.attachedTo(flag)
+	assert.True(ok)
+	assert.Equal(carrier, parent)
+	assert.Equal(mass+defaultFlagMass, carrier.mass)
+	assert.Equal([]ID{flag.id}, sim.attachedIDs(carrier))
+
+	// The flag moves with its carrier
+	carrier.position = mgl64.Vec3{0, 50, 0}
+	sim.moveAttachments()
+	assert.Equal(carrier.position.Add(flag.offset), flag.position)
+
+	// Destroyed carriers drop the flag where they are
+	dropped := flag.position
+	carrier.health = 0
+	sim.destroyShips()
+	_, ok = sim.attachedTo(flag)
+	assert.False(ok)
+	assert.Equal(dropped, flag.position)
+
+	// Touching your own dropped flag returns it home
+	defender, err := sim.AddShip("f2", flag.position, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	sim.mode.Score(sim)
+	assert.True(flag.isHome())
+	defender.position = mgl64.Vec3{0, -500, 0}
+
+	// Pick it up again and bring it home
+	runner, err := sim.AddShip("f1", flag.home, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	sim.mode.Score(sim)
+	runner.position = sim.bases["f1"]
+	sim.moveAttachments()
+
+	// No capture while the runner's own flag is away
+	ctf.flags["f1"].position = mgl64.Vec3{0, 0, 500}
+	sim.mode.Score(sim)
+	assert.Equal(0.0, sim.scores["f1"])
+
+	ctf.flags["f1"].returnHome()
+	sim.mode.Score(sim)
+	assert.True(flag.isHome())
+	assert.Equal(mass, runner.mass)
+	assert.Equal(float64(defaultFlagPoints), sim.scores["f1"])
+}
+
+func TestTeamsShareScoresAndSurvivors(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Mode: ModeDeathmatch, Score: 10},
+	})
+	sim.teams["f1"] = "red"
+	sim.teams["f2"] = "red"
+	for _, fleet := range []string{"f1", "f2", "f3"} {
+		if _, err := sim.AddShip(fleet, mgl64.Vec3{}, NewDud(), ShipConf{}); !assert.Nil(err) {
+			return
+		}
+	}
+	assert.Equal(2, sim.survivors["red"])
+	assert.Equal(1, sim.survivors["f3"])
+
+	sim.ships[2].lastAttacker = "red"
+	sim.ships[2].health = 0
+	sim.destroyShips()
+
+	assert.Equal(1.0, sim.scores["red"])
+	c, end := sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"red"}, c.Winners)
+}
+
+func TestFriendlyFire(t *testing.T) {
+	assert := assert.New(t)
+
+	friendlyFire := 0.5
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{FriendlyFire: &friendlyFire},
+	})
+	sim.teams["f1"] = "red"
+	sim.teams["f2"] = "red"
+	ally, err := sim.AddShip("f1", mgl64.Vec3{}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	enemy, err := sim.AddShip("f3", mgl64.Vec3{}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	p := newProjectile(mgl64.Vec3{}, mgl64.Vec3{}, 1, 1)
+	p.team = "red"
+
+	assert.Equal(0.5*defaultImpulseToDamage, sim.damageBetween(p, ally, defaultImpulseToDamage))
+	assert.Equal(defaultImpulseToDamage, sim.damageBetween(p, enemy, defaultImpulseToDamage))
+
+	// Friendly hits are not attributed as kills
+	sim.collided(p, ally)
+	assert.Equal("", ally.lastAttacker)
+	sim.collided(p, enemy)
+	assert.Equal("red", enemy.lastAttacker)
+}
+
+func TestTeamSizeLimit(t *testing.T) {
+	_, err := NewSimulation(
+		MapConf{
+			Radius:         1000,
+			StartingPoints: [][]float64{{0, 0, 0}, {10, 0, 0}, {20, 0, 0}},
+			Rules:          RulesConf{TeamSize: 1, MaxFleetMass: 1},
+		},
+		PartSetConf{},
+		[]FleetConf{
+			{Name: "f1", Team: "red"},
+			{Name: "f2", Team: "red"},
+		},
+		nil,
+		time.Second,
+		60,
+	)
+	assert.NotNil(t, err)
+}
+
+type respawnPilot struct {
+	GenericPilot
+	respawns int
+}
+
+func (p *respawnPilot) Tick(int64) {}
+
+func (p *respawnPilot) Respawned() {
+	p.respawns++
+}
+
+func TestRespawnShip(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Respawn: RespawnConf{Delay: 1, Lives: 1}},
+	})
+	spawn := mgl64.Vec3{10, 0, 0}
+	ship, err := sim.AddShip("f1", spawn, NewDud(), ShipConf{Pilot: "dud"})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.position = mgl64.Vec3{50, 0, 0}
+	ship.health = 0
+	sim.destroyShips()
+	assert.Len(sim.ships, 0)
+	assert.Len(sim.respawns, 1)
+
+	// Game continues while a ship is waiting to respawn
+	_, end := sim.mode.End(sim)
+	assert.False(end)
+
+	sim.tick = 999
+	sim.respawnShips()
+	assert.Len(sim.ships, 0)
+
+	sim.tick = 1000
+	sim.respawnShips()
+	if !assert.Len(sim.ships, 1) {
+		return
+	}
+	respawned := sim.ships[0]
+	assert.NotEqual(ship, respawned)
+	assert.Equal(spawn, respawned.position)
+	assert.Equal(0, respawned.lives)
+	assert.Equal(1, sim.survivors["f1"])
+
+	// No lives left
+	respawned.health = 0
+	sim.destroyShips()
+	assert.Len(sim.respawns, 0)
+}
+
+func TestRespawnReusesRespawner(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Respawn: RespawnConf{Delay: 1, Lives: -1}},
+	})
+	pilot := &respawnPilot{}
+	ship, err := sim.AddShip("f1", mgl64.Vec3{}, pilot, ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		ship.health = 0
+		sim.destroyShips()
+		sim.tick += 1000
+		sim.respawnShips()
+		if !assert.Len(sim.ships, 1) {
+			return
+		}
+		ship = sim.ships[0]
+		assert.Equal(pilot, ship.pilot)
+		assert.Equal(-1, ship.lives)
+	}
+	assert.Equal(3, pilot.respawns)
+}
+
+type closerPilot struct {
+	DudPilot
+	closed bool
+}
+
+func (p *closerPilot) Close() {
+	p.closed = true
+}
+
+type respawnCloserPilot struct {
+	closerPilot
+}
+
+func (p *respawnCloserPilot) Respawned() {}
+
+func TestPilotsClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Respawn: RespawnConf{Lives: 1}},
+	})
+	gone := &closerPilot{}
+	respawned := &respawnCloserPilot{}
+	alive := &closerPilot{}
+	for _, p := range []Pilot{gone, respawned, alive} {
+		ship, err := sim.AddShip("f1", mgl64.Vec3{}, p, ShipConf{Pilot: "dud"})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.lives = 1
+		if p == gone {
+			ship.lives = 0
+		}
+		ship.health = 0
+		if p == alive {
+			ship.health = 1
+		}
+	}
+	sim.destroyShips()
+	assert.True(gone.closed)
+	assert.False(respawned.closed)
+	assert.False(alive.closed)
+
+	sim.Close()
+	assert.True(respawned.closed)
+	assert.True(alive.closed)
+}
+
+func TestRespawnMassBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules:  RulesConf{Respawn: RespawnConf{Lives: -1, MassBudget: 15}},
+	})
+	for i := 0; i < 2; i++ {
+		ship, err := sim.AddShip("f1", mgl64.Vec3{}, NewDud(), ShipConf{Pilot: "dud"})
+		if !assert.Nil(err) {
+			return
+		}
+		// Spent ammunition does not reduce the cost of the rebuilt ship
+		ship.builtMass = 10
+		ship.mass = 4
+		ship.health = 0
+	}
+	sim.destroyShips()
+	assert.Len(sim.respawns, 1)
+	assert.Equal(10.0, sim.reinforcements["f1"])
+}
+
+func TestRaceNeedsCheckpoints(t *testing.T) {
+	_, err := NewSimulation(MapConf{Rules: RulesConf{Mode: ModeRace}}, PartSetConf{}, nil, nil, time.Second, 60)
+	assert.NotNil(t, err)
+}
+
+func TestRaceCheckpointsAndLaps(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Checkpoints: []CheckpointConf{
+			{Position: []float64{100, 0, 0}, Radius: 10},
+			{Position: []float64{-100, 0, 0}, Radius: 10},
+		},
+		Rules: RulesConf{Mode: ModeRace, Race: RaceConf{Laps: 2}},
+	})
+	if !assert.Len(sim.checkpoints, 2) {
+		return
+	}
+	sim.maxTicks = 10000
+	fast, err := sim.AddShip("f1", mgl64.Vec3{}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	slow, err := sim.AddShip("f2", mgl64.Vec3{}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+
+	// Checkpoints must be passed in order
+	fast.position = mgl64.Vec3{-100, 0, 0}
+	sim.mode.Score(sim)
+	assert.Equal(0, fast.nextCheckpoint)
+
+	for lap := 0; lap < 2; lap++ {
+		sim.tick += 1000
+		fast.position = mgl64.Vec3{100, 0, 0}
+		sim.mode.Score(sim)
+		sim.tick += 1000
+		fast.position = mgl64.Vec3{-100, 0, 0}
+		sim.mode.Score(sim)
+	}
+	assert.True(fast.finished)
+	assert.Equal(2, fast.lap)
+	assert.Equal(4.0, sim.scores["f1"])
+
+	c, end := sim.mode.End(sim)
+	assert.False(end)
+	assert.Equal([]string{"f1"}, c.Winners)
+	if assert.Len(c.Results, 1) {
+		assert.Equal(fast.id, c.Results[0].Ship)
+		assert.Equal([]float64{2, 2}, c.Results[0].LapTimes)
+		assert.Equal(4.0, c.Results[0].Time)
+	}
+
+	// Game ends once every ship has finished
+	slow.finished = true
+	c, end = sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"f1"}, c.Winners)
+}
+
+func TestVIPEscapeAndKill(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules: RulesConf{
+			Mode: ModeVIP,
+			VIP: VIPConf{
+				Exit:         CheckpointConf{Position: []float64{0, 500, 0}, Radius: 20},
+				EscapePoints: 3,
+				KillPoints:   2,
+			},
+		},
+	})
+	vips := make([]*shipT, 3)
+	for i, fleet := range []string{"f1", "f2", "f3"} {
+		ship, err := sim.AddShip(fleet, mgl64.Vec3{float64(i) * 100, 0, 0}, NewDud(), ShipConf{VIP: true})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.health = 1
+		vips[i] = ship
+	}
+	escort, err := sim.AddShip("f1", mgl64.Vec3{0, 0, 100}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	m := sim.mode.(*vip)
+	m.Start(sim)
+	if !assert.NotNil(m.exit) {
+		return
+	}
+
+	// Escorts entering the exit do not score
+	escort.position = mgl64.Vec3{0, 500, 0}
+	sim.mode.Score(sim)
+	assert.Equal(0.0, sim.scores["f1"])
+	assert.Len(m.vips, 3)
+
+	vips[0].position = mgl64.Vec3{0, 500, 0}
+	sim.mode.Score(sim)
+	assert.Equal(3.0, sim.scores["f1"])
+	_, end := sim.mode.End(sim)
+	assert.False(end)
+
+	vips[1].lastAttacker = "f3"
+	vips[1].health = 0
+	sim.destroyShips()
+	assert.Equal(2.0, sim.scores["f3"])
+	assert.Len(m.vips, 1)
+
+	// The last VIP can still escape
+	_, end = sim.mode.End(sim)
+	assert.False(end)
+
+	vips[2].position = mgl64.Vec3{0, 500, 0}
+	sim.mode.Score(sim)
+	c, end := sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"f3"}, c.Winners)
+}
+
+func TestVIPWithoutExit(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		Rules: RulesConf{
+			Mode:    ModeVIP,
+			Respawn: RespawnConf{Lives: -1},
+		},
+	})
+	vips := make([]*shipT, 2)
+	for i, fleet := range []string{"f1", "f2"} {
+		ship, err := sim.AddShip(fleet, mgl64.Vec3{float64(i) * 100, 0, 0}, NewDud(), ShipConf{Pilot: "dud", VIP: true})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.health = 1
+		vips[i] = ship
+	}
+	sim.mode.Score(sim)
+	_, end := sim.mode.End(sim)
+	assert.False(end)
+
+	// Destroyed VIPs do not respawn
+	vips[1].lastAttacker = "f1"
+	vips[1].health = 0
+	sim.destroyShips()
+	assert.Len(sim.respawns, 0)
+	c, end := sim.mode.End(sim)
+	assert.True(end)
+	assert.Equal([]string{"f1"}, c.Winners)
+}
+
+func TestVIPLimitPerFleet(t *testing.T) {
+	sim := newTestSim(t, MapConf{Radius: 1000, Rules: RulesConf{MaxFleetMass: 1}})
+	err := sim.addFleet(mgl64.Vec3{}, FleetConf{
+		Name: "f1",
+		Ships: []ShipConf{
+			{Pilot: "dud", VIP: true},
+			{Pilot: "dud", VIP: true},
+		},
+	}, 1)
+	assert.NotNil(t, err)
+}
+
+func TestVIPRequiredInVIPMode(t *testing.T) {
+	assert := assert.New(t)
+
+	fleet := FleetConf{Name: "f1", Ships: []ShipConf{{Pilot: "dud", Position: []float64{0, 0, 0}}}}
+	sim := newTestSim(t, MapConf{Radius: 1000, Rules: RulesConf{Mode: ModeVIP}})
+	assert.NotNil(sim.addFleet(mgl64.Vec3{}, fleet, 1))
+
+	fleet.Ships[0].VIP = true
+	assert.Nil(sim.addFleet(mgl64.Vec3{}, fleet, 1))
+
+	// Other modes do not need VIPs
+	sim = newTestSim(t, MapConf{Radius: 1000})
+	fleet.Ships[0].VIP = false
+	assert.Nil(sim.addFleet(mgl64.Vec3{}, fleet, 1))
+}
+
+func TestSensorIdentifiesNearbyVIP(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1000})
+	observer, err := sim.AddShip("f1", mgl64.Vec3{}, &sensorPilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	near, err := sim.AddShip("f2", mgl64.Vec3{50, 0, 0}, NewDud(), ShipConf{VIP: true})
+	if !assert.Nil(err) {
+		return
+	}
+	far, err := sim.AddShip("f2", mgl64.Vec3{0, 500, 0}, NewDud(), ShipConf{VIP: true})
+	if !assert.Nil(err) {
+		return
+	}
+	near.health = 1
+	far.health = 1
+	for i := 0; i < 3; i++ {
+		sim.doTick()
+	}
+	scan := observer.pilot.(*sensorPilot).scan
+	assert.True(scan.Ships[near.id].VIP)
+	assert.False(scan.Ships[far.id].VIP)
+	assert.Equal("f2", scan.Ships[far.id].Fleet)
+}
+
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) Draw(float64, map[string]float64, []Drawable, []Drawable, []ID) {}
+
+func (r *eventRecorder) LogEvent(t float64, name, action string) {
+	r.events = append(r.events, name)
+}
+
+func TestEventValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NotNil(EventConf{Action: "bogus", Time: 1}.Validate())
+	assert.NotNil(EventConf{Action: EventSpawnAsteroid}.Validate())
+	assert.NotNil(EventConf{Action: EventSpawnAsteroid, Time: -1}.Validate())
+	assert.Nil(EventConf{Action: EventSpawnAsteroid, Ships: 1}.Validate())
+}
+
+func TestEventsFire(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		ControlPoints: []ControlPointConf{
+			{Position: []float64{0, 0, 0}, Points: 1, Influence: 10},
+		},
+		Zones: []ZoneConf{
+			{Position: []float64{100, 0, 0}, Radius: 10},
+		},
+		Events: []EventConf{
+			{
+				Name:     "rocks",
+				Action:   EventSpawnAsteroid,
+				Time:     1,
+				Asteroid: AsteroidConf{Position: []float64{0, 200, 0}, Velocity: []float64{0, -10, 0}, Mass: 1, Radius: 1},
+			},
+			{Name: "shutdown", Action: EventDeactivateControlPoint, Score: 0.5},
+			{Name: "clear", Action: EventCloseZone, Target: 0, Time: 1},
+			{Name: "double", Action: EventSetPoints, Target: 0, Points: 2, Time: 1},
+		},
+	})
+	recorder := &eventRecorder{}
+	sim.stream = recorder
+	ship, err := sim.AddShip("f1", mgl64.Vec3{}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 1
+
+	sim.processEvents()
+	assert.Len(recorder.events, 0)
+
+	// Score enough to deactivate the control point
+	for i := 0; i < 600; i++ {
+		sim.mode.Score(sim)
+	}
+	sim.processEvents()
+	assert.Equal([]string{"shutdown"}, recorder.events)
+	assert.True(sim.ctlps[0].inactive)
+	score := sim.scores["f1"]
+	sim.mode.Score(sim)
+	assert.Equal(score, sim.scores["f1"])
+
+	sim.tick = 1000
+	sim.processEvents()
+	assert.Equal([]string{"shutdown", "rocks", "clear", "double"}, recorder.events)
+	if assert.Len(sim.astds, 1) {
+		assert.Equal(mgl64.Vec3{0, -10, 0}, sim.astds[0].velocity)
+	}
+	assert.Len(sim.zones, 0)
+	assert.Len(sim.zoneSRs, 0)
+	assert.Equal(2.0, sim.ctlps[0].points)
+
+	// Events only fire once
+	sim.processEvents()
+	assert.Len(recorder.events, 4)
+}
+
+func TestNeutralShips(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1000,
+		ControlPoints: []ControlPointConf{
+			{Position: []float64{0, 0, 0}, Points: 1, Influence: 10},
+		},
+		NPCs: []ShipConf{
+			{Pilot: "dud", Position: []float64{1, 0, 0}},
+		},
+		Rules: RulesConf{Mode: ModeDeathmatch},
+	})
+	if !assert.Len(sim.ships, 1) {
+		return
+	}
+	npc := sim.ships[0]
+	npc.health = 1
+	assert.True(npc.npc)
+	assert.Equal(NeutralFleet, npc.team)
+	assert.Len(sim.survivors, 0)
+
+	ship, err := sim.AddShip("f1", mgl64.Vec3{100, 0, 0}, NewDud(), ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 1
+
+	// Neutral ships do not capture control points
+	m := &kingOfTheHill{}
+	m.Score(sim)
+	assert.Equal("", sim.ctlps[0].owner)
+
+	// Neutral ships are not credited with damage
+	p := newProjectile(mgl64.Vec3{}, mgl64.Vec3{}, 1, 1)
+	p.team = NeutralFleet
+	sim.collided(p, ship)
+	assert.Equal("", ship.lastAttacker)
+
+	// Destroying a neutral ship does not score
+	npc.lastAttacker = "f1"
+	npc.health = 0
+	sim.destroyShips()
+	assert.Len(sim.ships, 1)
+	assert.Equal(0.0, sim.scores["f1"])
+	assert.Equal(1, sim.survivors["f1"])
+	_, end := sim.mode.End(sim)
+	assert.True(end)
+}
+
+func TestNeutralShipsKeepPracticeMapsRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, mode := range []string{ModeKingOfTheHill, ModeDeathmatch, ModeCaptureTheFlag, ModeLastFleetStanding} {
+		sim := newTestSim(t, MapConf{
+			Radius: 1000,
+			NPCs: []ShipConf{
+				{Pilot: "dud", Position: []float64{1, 0, 0}},
+			},
+			Rules: RulesConf{Mode: mode},
+		})
+		npc := sim.ships[0]
+		npc.health = 1
+		ship, err := sim.AddShip("f1", mgl64.Vec3{100, 0, 0}, NewDud(), ShipConf{})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.health = 1
+		sim.scores["f1"] = 0
+
+		// A single fleet keeps playing while neutral ships remain
+		_, end := sim.mode.End(sim)
+		assert.False(end, mode)
+
+		npc.health = 0
+		sim.destroyShips()
+		c, end := sim.mode.End(sim)
+		assert.True(end, mode)
+		assert.Equal([]string{"f1"}, c.Winners, mode)
+
+		// Or until time runs out
+		sim = newTestSim(t, MapConf{
+			Radius: 1000,
+			NPCs: []ShipConf{
+				{Pilot: "dud", Position: []float64{1, 0, 0}},
+			},
+			Rules: RulesConf{Mode: mode},
+		})
+		sim.ships[0].health = 1
+		ship, err = sim.AddShip("f1", mgl64.Vec3{100, 0, 0}, NewDud(), ShipConf{})
+		if !assert.Nil(err) {
+			return
+		}
+		ship.health = 1
+		sim.tick = sim.maxTicks
+		c, end = sim.mode.End(sim)
+		assert.True(end, mode)
+		assert.Equal("max ticks reached", c.Reason, mode)
+	}
+}
+
+func TestNeutralFleetNameReserved(t *testing.T) {
+	_, err := NewSimulation(
+		MapConf{
+			Radius:         1000,
+			StartingPoints: [][]float64{{0, 0, 0}},
+		},
+		PartSetConf{},
+		[]FleetConf{{Name: NeutralFleet}},
+		nil,
+		time.Second,
+		60,
+	)
+	assert.NotNil(t, err)
+}
+
+type commsPilot struct {
+	GenericPilot
+	send int64
+	// Ticks before the first scan
+	firstScan int64
+	sendErr   error
+	twiceErr error
+	received map[int64][]Message
+}
+
+func (self *commsPilot) LinkParts(shipParts []ShipPartConf, availableParts PartSetConf) ([]Part, error) {
+	self.Engines = []*Engine{NewEngine001(mgl64.Vec3{0, 0, 0})}
+	self.Sensors = []*Sensor{NewSensor001(mgl64.Vec3{7, 0, 0})}
+	self.Comms = []*Comms{NewCommsFromConf(mgl64.Vec3{-7, 0, 0}, CommsConf{Mass: 1, Radius: 1, Energy: 1, Range: 100, MaxSize: 4})}
+	self.received = make(map[int64][]Message)
+	return []Part{self.Engines[0], self.Sensors[0], self.Comms[0]}, nil
+}
+
+func (self *commsPilot) Tick(tick int64) {
+	self.Engines[0].PowerOn(1)
+	if tick == self.send {
+		self.sendErr = self.Comms[0].Broadcast([]byte("hi"))
+		self.twiceErr = self.Comms[0].Broadcast([]byte("x"))
+	}
+	if tick < self.firstScan {
+		return
+	}
+	if scan, err := self.Sensors[0].Scan(); err == nil && len(scan.Messages) > 0 {
+		self.received[tick] = scan.Messages
+	}
+}
+
+func TestCommsBroadcast(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1000})
+	add := func(fleet string, pos mgl64.Vec3, p Pilot) *shipT {
+		ship, err := sim.AddShip(fleet, pos, p, ShipConf{HullStrength: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ship
+	}
+	sender := &commsPilot{send: 5}
+	near := &commsPilot{send: -1}
+	far := &commsPilot{send: -1}
+	enemy := &commsPilot{send: -1}
+	noComms := &sensorPilot{}
+	// The first scan has no results, so the message waits a tick
+	late := &commsPilot{send: -1, firstScan: 6}
+	s := add("f1", mgl64.Vec3{}, sender)
+	add("f1", mgl64.Vec3{50, 0, 0}, near)
+	add("f1", mgl64.Vec3{-50, 0, 0}, late)
+	add("f1", mgl64.Vec3{0, 500, 0}, far)
+	add("f2", mgl64.Vec3{0, 50, 0}, enemy)
+	add("f1", mgl64.Vec3{0, 0, 50}, noComms)
+	for i := 0; i < 10; i++ {
+		sim.doTick()
+	}
+
+	assert.Nil(sender.sendErr)
+	assert.NotNil(sender.twiceErr)
+	// Received with the scan one tick after the broadcast
+	if assert.Len(near.received, 1) && assert.Len(near.received[6], 1) {
+		msg := near.received[6][0]
+		assert.Equal(s.id, msg.From)
+		assert.Equal("hi", string(msg.Data))
+	}
+	if assert.Len(late.received, 1) && assert.Len(late.received[7], 1) {
+		assert.Equal("hi", string(late.received[7][0].Data))
+	}
+	assert.Len(sender.received, 0)
+	assert.Len(far.received, 0)
+	assert.Len(enemy.received, 0)
+
+	// Messages are bounded in size
+	assert.NotNil(sender.Comms[0].Broadcast([]byte("too long")))
+}
+
+func TestZoneRepairAndResupply(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{
+		Radius: 1e4,
+		Zones: []ZoneConf{
+			{Position: []float64{0, 0, 0}, Radius: 100, Repair: 1000, Resupply: 1500},
+		},
+	})
+	ship, err := sim.AddShip("f1", mgl64.Vec3{}, &pointDefencePilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	w := ship.weapons[0]
+	mass := ship.mass
+	assert.Equal(int64(100), w.GetAmmoCapacity())
+
+	// Ammo is restored in whole rounds and adds back its mass
+	w.ammoCapacity = 95
+	ship.mass -= 5 * w.ammoMass
+	ship.health = ship.maxHealth - 1.5
+	sim.doTick()
+	assert.Equal(int64(96), w.GetAmmo())
+	assert.InDelta(ship.maxHealth-0.5, ship.health, 1e-9)
+	for i := 0; i < 10; i++ {
+		sim.doTick()
+	}
+	assert.Equal(int64(100), w.GetAmmo())
+	assert.InDelta(mass, ship.mass, 1e-9)
+	assert.Equal(ship.maxHealth, ship.health)
+
+	_, err = NewZone(1, ZoneConf{Radius: 1, Repair: -1})
+	assert.NotNil(err)
+}
+
+func TestSensorScansNearbyProjectiles(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1e4})
+	ship, err := sim.AddShip("f1", mgl64.Vec3{}, &sensorPilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	near := newProjectile(mgl64.Vec3{0, 200, 0}, mgl64.Vec3{}, 1, 0.5)
+	near.team = "f2"
+	sim.addProjectile(near)
+	sim.addProjectile(newProjectile(mgl64.Vec3{0, 0, 1000}, mgl64.Vec3{}, 1, 0.5))
+	for i := 0; i < 3; i++ {
+		sim.doTick()
+	}
+	scan := ship.pilot.(*sensorPilot).scan
+	if assert.Len(scan.Projectiles, 1) {
+		assert.Equal("f2", scan.Projectiles[0].Team)
+		assert.Equal(0.5, scan.Projectiles[0].Radius)
+	}
+
+	// Dampening zones hide projectiles inside them
+	sim = newTestSim(t, MapConf{
+		Radius: 1e4,
+		Zones: []ZoneConf{
+			{Position: []float64{0, 200, 0}, Radius: 10, SensorDampening: 1},
+		},
+	})
+	ship, err = sim.AddShip("f1", mgl64.Vec3{}, &sensorPilot{}, ShipConf{HullStrength: 1})
+	if !assert.Nil(err) {
+		return
+	}
+	sim.addProjectile(newProjectile(mgl64.Vec3{0, 200, 0}, mgl64.Vec3{}, 1, 0.5))
+	sim.addProjectile(newProjectile(mgl64.Vec3{0, -200, 0}, mgl64.Vec3{}, 1, 0.5))
+	for i := 0; i < 3; i++ {
+		sim.doTick()
+	}
+	scan = ship.pilot.(*sensorPilot).scan
+	if assert.Len(scan.Projectiles, 1) {
+		assert.Equal(mgl64.Vec3{0, -200, 0}, scan.Projectiles[0].Position)
+	}
+
+	// More powerful sensors detect projectiles farther away
+	ship.pilot.(*sensorPilot).Sensors[0].power = 100
+	sim.addProjectile(newProjectile(mgl64.Vec3{0, 0, 1000}, mgl64.Vec3{}, 1, 0.5))
+	for i := 0; i < 2; i++ {
+		sim.doTick()
+	}
+	assert.Len(ship.pilot.(*sensorPilot).scan.Projectiles, 2)
+}
+
+type paramsPilot struct {
+	GenericPilot
+	params struct {
+		Speed float64 `yaml:"speed"`
+		Mode  string  `yaml:"mode"`
+	}
+}
+
+func (p *paramsPilot) Configure(conf ShipConf) error {
+	return DecodePilotParams(conf.PilotParams, &p.params)
+}
+
+func (p *paramsPilot) Tick(int64) {}
+
+func TestPilotParams(t *testing.T) {
+	assert := assert.New(t)
+
+	var configured []*paramsPilot
+	RegisterPilot("test_params", func() Pilot {
+		p := &paramsPilot{}
+		p.params.Speed = 1
+		configured = append(configured, p)
+		return p
+	})
+	newSim := func(conf ShipConf) error {
+		conf.Position = []float64{0, 0, 0}
+		_, err := NewSimulation(
+			MapConf{
+				Radius:         1000,
+				StartingPoints: [][]float64{{0, 0, 0}},
+			},
+			PartSetConf{},
+			[]FleetConf{{Name: "f1", Ships: []ShipConf{conf}}},
+			nil,
+			time.Second,
+			60,
+		)
+		return err
+	}
+
+	// Missing params keep their defaults
+	assert.Nil(newSim(ShipConf{Pilot: "test_params", PilotParams: map[string]interface{}{"mode": "fast"}}))
+	if assert.Len(configured, 1) {
+		assert.Equal(1.0, configured[0].params.Speed)
+		assert.Equal("fast", configured[0].params.Mode)
+	}
+	// Integers decode into floats
+	assert.Nil(newSim(ShipConf{Pilot: "test_params", PilotParams: map[string]interface{}{"speed": 12}}))
+	if assert.Len(configured, 2) {
+		assert.Equal(12.0, configured[1].params.Speed)
+	}
+
+	err := newSim(ShipConf{Pilot: "test_params", PilotParams: map[string]interface{}{"sped": 12}})
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "sped")
+	}
+	err = newSim(ShipConf{Pilot: "test_params", PilotParams: map[string]interface{}{"speed": "fast"}})
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "speed")
+	}
+	err = newSim(ShipConf{Pilot: "dud", PilotParams: map[string]interface{}{"speed": 12}})
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "does not accept pilot_params")
+	}
+}
+
+type debugRecorder struct {
+	eventRecorder
+}
+
+func (r *debugRecorder) DrawDebug(float64, map[ID][]DebugShape) {}
+
+type debugDrawPilot struct {
+	GenericPilot
+}
+
+func (self *debugDrawPilot) Tick(tick int64) {
+	switch tick {
+	case 0:
+		self.DebugLine(mgl64.Vec3{}, mgl64.Vec3{1, 0, 0}, "#ff0000")
+		self.DebugTarget(7)
+	case 2:
+		self.DebugSphere(mgl64.Vec3{}, 5, "")
+	}
+}
+
+func TestDebugShapes(t *testing.T) {
+	assert := assert.New(t)
+
+	sim := newTestSim(t, MapConf{Radius: 1000})
+	sim.stream = &debugRecorder{}
+	sim.EnableDebug()
+	ship, err := sim.AddShip("f1", mgl64.Vec3{}, &debugDrawPilot{}, ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 1
+	assert.True(ship.pilot.(*debugDrawPilot).Debugging())
+
+	sim.doTick()
+	shapes := sim.collectDebug()
+	if assert.Len(shapes[ship.id], 2) {
+		assert.Equal(DebugShape{Kind: DebugLine, End: mgl64.Vec3{1, 0, 0}, Color: "#ff0000"}, shapes[ship.id][0])
+		assert.Equal(DebugShape{Kind: DebugTarget, Target: 7}, shapes[ship.id][1])
+	}
+	// Shapes last until the pilot draws again
+	sim.doTick()
+	assert.Len(sim.collectDebug()[ship.id], 2)
+	sim.doTick()
+	assert.Equal([]DebugShape{{Kind: DebugSphere, Radius: 5}}, sim.collectDebug()[ship.id])
+
+	// Nothing is recorded unless debugging is enabled, even for a DebugDrawer
+	sim = newTestSim(t, MapConf{Radius: 1000})
+	sim.stream = &debugRecorder{}
+	ship, err = sim.AddShip("f1", mgl64.Vec3{}, &debugDrawPilot{}, ShipConf{})
+	if !assert.Nil(err) {
+		return
+	}
+	ship.health = 1
+	sim.doTick()
+	assert.False(ship.pilot.(*debugDrawPilot).Debugging())
+	assert.Len(sim.collectDebug(), 0)
+
+	// Enabling debugging applies to ships already added
+	sim.EnableDebug()
+	assert.True(ship.pilot.(*debugDrawPilot).Debugging())
+}
@@ -1,4 +1,208 @@
+// Package target implements a fire-control computer that tracks enemy ships
+// across scans, chooses which to engage and aims weapons to intercept them.
 package target
 
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+)
+
+// Weight given to the newest acceleration sample, smoothing out noise between scans.
+const accelSmoothing = 0.5
+
+// Maximum number of refinements of the intercept time when the target is accelerating.
+const aimIterations = 20
+
+// Successive intercept times within this many seconds of each other have converged.
+const aimTolerance = 1e-4
+
+// A Track follows a single ship across scans.
+type Track struct {
+	ID           avi.ID
+	Ship         avi.ShipSR
+	Acceleration mgl64.Vec3
+	// Tick the ship was last seen
+	Tick int64
+
+	accelerating bool
+}
+
+func (t *Track) Position() mgl64.Vec3 {
+	return t.Ship.Position
+}
+
+func (t *Track) Velocity() mgl64.Vec3 {
+	return t.Ship.Velocity
+}
+
+// A Policy scores how much of a threat a tracked ship is to the scanning ship,
+// the highest scoring track is chosen as the target.
+type Policy func(self avi.ScanResult, t *Track) float64
+
+// Nearest prefers the closest ship.
+func Nearest(self avi.ScanResult, t *Track) float64 {
+	return -t.Position().Sub(self.Position).Len()
+}
+
+// Closing prefers ships approaching fastest relative to their distance,
+// those that will reach us soonest.
+func Closing(self avi.ScanResult, t *Track) float64 {
+	deltaPos := t.Position().Sub(self.Position)
+	deltaVel := t.Velocity().Sub(self.Velocity)
+	d := deltaPos.Len()
+	if d == 0 {
+		return math.Inf(1)
+	}
+	return -deltaVel.Dot(deltaPos) / (d * d)
+}
+
+// VIPFirst prefers identified VIPs, falling back to the policy among equals.
+func VIPFirst(p Policy) Policy {
+	return func(self avi.ScanResult, t *Track) float64 {
+		s := p(self, t)
+		if t.Ship.VIP {
+			// Shift VIP scores above all others without losing their order
+			return math.Atan(s) + 2*math.Pi
+		}
+		return math.Atan(s)
+	}
+}
+
+// TargetComputer tracks enemy ships and picks and aims at a target.
 type TargetComputer struct {
+	// Ships of this team are never tracked
+	Team string
+	// Ships farther away are not targeted, zero means unlimited
+	MaxRange float64
+	// Keep the current target while it remains in range instead of reselecting every scan
+	Sticky bool
+	// Policy used to choose a target, defaults to Nearest
+	Policy Policy
+
+	tracks map[avi.ID]*Track
+	target avi.ID
+}
+
+func NewTargetComputer(team string) *TargetComputer {
+	return &TargetComputer{
+		Team:   team,
+		Policy: Nearest,
+		tracks: make(map[avi.ID]*Track),
+		target: avi.NilID,
+	}
+}
+
+// Update the tracks from a scan taken at tick, dropping ships no longer seen.
+func (tc *TargetComputer) Update(tick int64, scan avi.ScanResult) {
+	for id, ship := range scan.Ships {
+		if tc.Team != "" && ship.Team == tc.Team {
+			continue
+		}
+		t, ok := tc.tracks[id]
+		if !ok {
+			tc.tracks[id] = &Track{ID: id, Ship: ship, Tick: tick}
+			continue
+		}
+		if dt := float64(tick-t.Tick) * avi.SecondsPerTick; dt > 0 {
+			acc := ship.Velocity.Sub(t.Ship.Velocity).Mul(1 / dt)
+			if t.accelerating {
+				acc = t.Acceleration.Mul(1 - accelSmoothing).Add(acc.Mul(accelSmoothing))
+			}
+			t.Acceleration = acc
+			t.accelerating = true
+		}
+		t.Ship = ship
+		t.Tick = tick
+	}
+	for id, t := range tc.tracks {
+		if t.Tick != tick {
+			delete(tc.tracks, id)
+		}
+	}
+	if _, ok := tc.tracks[tc.target]; !ok {
+		tc.target = avi.NilID
+	}
+}
+
+// Track returns the track of a ship if it is being tracked.
+func (tc *TargetComputer) Track(id avi.ID) (*Track, bool) {
+	t, ok := tc.tracks[id]
+	return t, ok
+}
+
+// Tracks returns all tracks ordered by ID.
+func (tc *TargetComputer) Tracks() []*Track {
+	tracks := make([]*Track, 0, len(tc.tracks))
+	for _, t := range tc.tracks {
+		tracks = append(tracks, t)
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].ID < tracks[j].ID })
+	return tracks
+}
+
+// Target chooses the track to engage, returning false if nothing is in range.
+func (tc *TargetComputer) Target(scan avi.ScanResult) (*Track, bool) {
+	if t, ok := tc.tracks[tc.target]; ok && tc.Sticky && tc.inRange(scan, t) {
+		return t, true
+	}
+	policy := tc.Policy
+	if policy == nil {
+		policy = Nearest
+	}
+	var best *Track
+	bestScore := math.Inf(-1)
+	for _, t := range tc.Tracks() {
+		if !tc.inRange(scan, t) {
+			continue
+		}
+		if s := policy(scan, t); best == nil || s > bestScore {
+			best = t
+			bestScore = s
+		}
+	}
+	if best == nil {
+		tc.target = avi.NilID
+		return nil, false
+	}
+	tc.target = best.ID
+	return best, true
+}
+
+func (tc *TargetComputer) inRange(scan avi.ScanResult, t *Track) bool {
+	return tc.MaxRange <= 0 || avi.LengthSq(t.Position().Sub(scan.Position)) <= tc.MaxRange*tc.MaxRange
+}
+
+// Aim returns the direction to fire a weapon with ammo speed va to intercept the track,
+// and the time until impact. Returns false if the projectile cannot catch the target.
+func (tc *TargetComputer) Aim(scan avi.ScanResult, t *Track, va float64) (mgl64.Vec3, float64, bool) {
+	return Solve(t.Position().Sub(scan.Position), t.Velocity().Sub(scan.Velocity), t.Acceleration, va)
+}
+
+// Solve finds the direction to fire a projectile with speed va, relative to the shooter,
+// to hit a target at deltaPos moving with deltaVel and accelerating with acc,
+// and the time until impact. Returns false if no intercept exists.
+func Solve(deltaPos, deltaVel, acc mgl64.Vec3, va float64) (mgl64.Vec3, float64, bool) {
+	t := avi.InterceptTime(deltaPos, deltaVel, va)
+	if t <= 0 {
+		return mgl64.Vec3{}, -1, false
+	}
+	aim := deltaPos.Add(deltaVel.Mul(t))
+	if avi.LengthSq(acc) > 0 {
+		// The projectile must travel to where the target will be, which in turn depends on the flight time
+		converged := false
+		for i := 0; i < aimIterations && !converged; i++ {
+			aim = deltaPos.Add(deltaVel.Mul(t)).Add(acc.Mul(0.5 * t * t))
+			next := aim.Len() / va
+			converged = math.Abs(next-t) < aimTolerance
+			t = next
+		}
+		if !converged || t <= 0 || math.IsNaN(t) || math.IsInf(t, 0) {
+			return mgl64.Vec3{}, -1, false
+		}
+		aim = deltaPos.Add(deltaVel.Mul(t)).Add(acc.Mul(0.5 * t * t))
+	}
+	return aim.Mul(1 / t), t, true
 }
@@ -0,0 +1,156 @@
+package target_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/target"
+)
+
+// Fly a projectile along the aim and the target along its path, returning the closest approach.
+func missDistance(shooter, shooterVel, pos, vel, acc, dir mgl64.Vec3, va, flight float64) float64 {
+	projVel := dir.Normalize().Mul(va).Add(shooterVel)
+	closest := math.Inf(1)
+	for tick := 0; float64(tick)*avi.SecondsPerTick < 2*flight; tick++ {
+		tm := float64(tick) * avi.SecondsPerTick
+		p := shooter.Add(projVel.Mul(tm))
+		q := pos.Add(vel.Mul(tm)).Add(acc.Mul(0.5 * tm * tm))
+		if d := p.Sub(q).Len(); d < closest {
+			closest = d
+		}
+	}
+	return closest
+}
+
+func TestSolveMovingTargets(t *testing.T) {
+	testCases := []struct {
+		name          string
+		pos, vel, acc mgl64.Vec3
+		shooterVel    mgl64.Vec3
+	}{
+		{name: "stationary", pos: mgl64.Vec3{500, 0, 0}},
+		{name: "crossing", pos: mgl64.Vec3{500, 0, 0}, vel: mgl64.Vec3{0, 80, 0}},
+		{name: "receding", pos: mgl64.Vec3{300, 300, 0}, vel: mgl64.Vec3{50, 50, 20}},
+		{name: "accelerating", pos: mgl64.Vec3{400, -100, 50}, vel: mgl64.Vec3{0, 40, 0}, acc: mgl64.Vec3{0, 0, 30}},
+		{name: "moving shooter", pos: mgl64.Vec3{500, 0, 0}, vel: mgl64.Vec3{0, 60, 0}, shooterVel: mgl64.Vec3{20, -30, 10}},
+	}
+	va := 300.0
+	for _, tc := range testCases {
+		dir, flight, ok := target.Solve(tc.pos, tc.vel.Sub(tc.shooterVel), tc.acc, va)
+		if !ok {
+			t.Errorf("%s: no intercept", tc.name)
+			continue
+		}
+		if d := missDistance(mgl64.Vec3{}, tc.shooterVel, tc.pos, tc.vel, tc.acc, dir, va, flight); d > 1 {
+			t.Errorf("%s: missed by %f", tc.name, d)
+		}
+	}
+
+	// A faster target moving away cannot be caught
+	if _, _, ok := target.Solve(mgl64.Vec3{100, 0, 0}, mgl64.Vec3{400, 0, 0}, mgl64.Vec3{}, va); ok {
+		t.Error("expected no intercept for a faster receding target")
+	}
+
+	// Accelerating away too hard, the intercept time never converges
+	if _, _, ok := target.Solve(mgl64.Vec3{300, 0, 0}, mgl64.Vec3{}, mgl64.Vec3{1000, 0, 0}, va); ok {
+		t.Error("expected no intercept for a target accelerating away")
+	}
+}
+
+func TestTrackingEstimatesAcceleration(t *testing.T) {
+	tc := target.NewTargetComputer("us")
+	acc := mgl64.Vec3{0, 10, 0}
+	for tick := int64(0); tick < 10; tick++ {
+		tm := float64(tick) * avi.SecondsPerTick
+		tc.Update(tick, avi.ScanResult{
+			Ships: map[avi.ID]avi.ShipSR{
+				1: {Team: "them", Position: acc.Mul(0.5 * tm * tm), Velocity: acc.Mul(tm)},
+				2: {Team: "us"},
+			},
+		})
+	}
+	tr, ok := tc.Track(1)
+	if !ok {
+		t.Fatal("expected track of enemy ship")
+	}
+	if d := tr.Acceleration.Sub(acc).Len(); d > 1e-6 {
+		t.Errorf("unexpected acceleration %v", tr.Acceleration)
+	}
+	if _, ok := tc.Track(2); ok {
+		t.Error("team mate should not be tracked")
+	}
+
+	// Ships that leave the scan are dropped
+	tc.Update(10, avi.ScanResult{Ships: map[avi.ID]avi.ShipSR{}})
+	if len(tc.Tracks()) != 0 {
+		t.Errorf("unexpected tracks %v", tc.Tracks())
+	}
+}
+
+func TestTargetSelection(t *testing.T) {
+	scan := avi.ScanResult{
+		Ships: map[avi.ID]avi.ShipSR{
+			// Near but moving away
+			1: {Position: mgl64.Vec3{100, 0, 0}, Velocity: mgl64.Vec3{10, 0, 0}},
+			// Farther but closing fast
+			2: {Position: mgl64.Vec3{0, 200, 0}, Velocity: mgl64.Vec3{0, -100, 0}},
+			// Farthest and a VIP
+			3: {Position: mgl64.Vec3{0, 0, 400}, VIP: true},
+		},
+	}
+	testCases := []struct {
+		name     string
+		policy   target.Policy
+		maxRange float64
+		exp      avi.ID
+	}{
+		{name: "nearest", policy: target.Nearest, exp: 1},
+		{name: "closing", policy: target.Closing, exp: 2},
+		{name: "vip", policy: target.VIPFirst(target.Nearest), exp: 3},
+		{name: "vip out of range", policy: target.VIPFirst(target.Nearest), maxRange: 300, exp: 1},
+	}
+	for _, tc := range testCases {
+		c := target.NewTargetComputer("")
+		c.Policy = tc.policy
+		c.MaxRange = tc.maxRange
+		c.Update(0, scan)
+		tr, ok := c.Target(scan)
+		if !ok || tr.ID != tc.exp {
+			t.Errorf("%s: expected target %d got %v", tc.name, tc.exp, tr)
+		}
+	}
+
+	c := target.NewTargetComputer("")
+	c.MaxRange = 50
+	c.Update(0, scan)
+	if _, ok := c.Target(scan); ok {
+		t.Error("expected no target in range")
+	}
+}
+
+func TestStickyTarget(t *testing.T) {
+	c := target.NewTargetComputer("")
+	c.Sticky = true
+	scan := avi.ScanResult{Ships: map[avi.ID]avi.ShipSR{1: {Position: mgl64.Vec3{100, 0, 0}}}}
+	c.Update(0, scan)
+	if tr, ok := c.Target(scan); !ok || tr.ID != 1 {
+		t.Fatalf("unexpected target %v", tr)
+	}
+	// A nearer ship appears but the current target is kept
+	scan.Ships = map[avi.ID]avi.ShipSR{
+		1: {Position: mgl64.Vec3{100, 0, 0}},
+		2: {Position: mgl64.Vec3{10, 0, 0}},
+	}
+	c.Update(1, scan)
+	if tr, ok := c.Target(scan); !ok || tr.ID != 1 {
+		t.Errorf("expected to keep target, got %v", tr)
+	}
+	// Once lost the nearest is chosen
+	scan.Ships = map[avi.ID]avi.ShipSR{2: {Position: mgl64.Vec3{10, 0, 0}}}
+	c.Update(2, scan)
+	if tr, ok := c.Target(scan); !ok || tr.ID != 2 {
+		t.Errorf("expected new target, got %v", tr)
+	}
+}
@@ -52,6 +52,19 @@ func (self *Thruster) GetForce() float64 {
 	return self.force
 }
 
+// Energy used per tick when firing at full force.
+func (self *Thruster) GetEnergy() float64 {
+	return self.energy
+}
+
+// Energy the ship's engines have left this tick to power the thruster.
+func (self *Thruster) GetAvailableEnergy() float64 {
+	if self.ship == nil {
+		return 0
+	}
+	return self.ship.currentEnergy
+}
+
 // Fire the thruster the length of dir indicates how hard
 // to fire the thruster. The length should equal to the
 // accerlation to apply to the ship.
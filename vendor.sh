@@ -37,5 +37,14 @@ do
     else
         git subrepo clone "$uri" "$dir" $barg
     fi
+
+    # Reapply local changes to the package
+    patch="vendor.patches/$package.patch"
+    if [ -f "$patch" ]
+    then
+        git apply "$patch"
+        git add "$dir"
+        git commit -m "Patch vendored $package"
+    fi
 done < vendor.list
 
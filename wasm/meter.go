@@ -0,0 +1,472 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Name of the global added to modules to hold the fuel left for the current call.
+const fuelExport = "avi_fuel"
+
+// Order sections must appear in, by section id. Custom sections may appear anywhere.
+var sectionOrder = map[byte]int{
+	1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 13: 6, 6: 7, 7: 8, 8: 9, 9: 10, 12: 11, 10: 12, 11: 13,
+}
+
+const (
+	sectionImport = 2
+	sectionGlobal = 6
+	sectionExport = 7
+	sectionCode   = 10
+)
+
+var errTruncated = errors.New("unexpected end of module")
+
+type reader struct {
+	b   []byte
+	pos int
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.b)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errTruncated
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c, nil
+}
+
+func (r *reader) skip(n int) error {
+	if n < 0 || r.pos+n > len(r.b) {
+		return errTruncated
+	}
+	r.pos += n
+	return nil
+}
+
+// Read an unsigned LEB128 value.
+func (r *reader) u32() (uint32, error) {
+	var v uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		c, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("invalid LEB128 value")
+}
+
+// Skip a signed LEB128 value of up to 64 bits.
+func (r *reader) skipSigned() error {
+	for i := 0; i < 10; i++ {
+		c, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if c&0x80 == 0 {
+			return nil
+		}
+	}
+	return errors.New("invalid LEB128 value")
+}
+
+// Skip a vector of u32 values.
+func (r *reader) skipU32s(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.u32(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeU32(v uint32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+type moduleSection struct {
+	id   byte
+	data []byte
+}
+
+// Instrument a module so every function entry and loop iteration burns one unit of fuel
+// from an exported i64 global, trapping once the fuel runs out.
+// The host refills the global before each call, metering modules deterministically.
+func instrument(code []byte) ([]byte, error) {
+	if len(code) < 8 {
+		return nil, errTruncated
+	}
+	r := &reader{b: code, pos: 8}
+	var sections []moduleSection
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		start := r.pos
+		if err := r.skip(int(size)); err != nil {
+			return nil, err
+		}
+		sections = append(sections, moduleSection{id: id, data: code[start:r.pos]})
+	}
+
+	// The fuel global follows the imported and defined globals
+	var global uint32
+	for _, s := range sections {
+		var n uint32
+		var err error
+		switch s.id {
+		case sectionImport:
+			n, err = importedGlobals(s.data)
+		case sectionGlobal:
+			n, err = (&reader{b: s.data}).u32()
+		}
+		if err != nil {
+			return nil, err
+		}
+		global += n
+	}
+
+	// i64 mutable global initialised to zero
+	fuel := []byte{0x7e, 0x01, 0x42, 0x00, 0x0b}
+	export := append(append(encodeU32(uint32(len(fuelExport))), fuelExport...), 0x03)
+	export = append(export, encodeU32(global)...)
+
+	var err error
+	sections, err = appendEntry(sections, sectionGlobal, fuel)
+	if err != nil {
+		return nil, err
+	}
+	sections, err = appendEntry(sections, sectionExport, export)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range sections {
+		if s.id == sectionCode {
+			if sections[i].data, err = meterCode(s.data, global); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	out := append([]byte{}, code[:8]...)
+	for _, s := range sections {
+		out = append(out, s.id)
+		out = append(out, encodeU32(uint32(len(s.data)))...)
+		out = append(out, s.data...)
+	}
+	return out, nil
+}
+
+// Count the globals in an import section.
+func importedGlobals(data []byte) (uint32, error) {
+	r := &reader{b: data}
+	n, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	var globals uint32
+	for i := uint32(0); i < n; i++ {
+		// Module and field names
+		for j := 0; j < 2; j++ {
+			l, err := r.u32()
+			if err != nil {
+				return 0, err
+			}
+			if err := r.skip(int(l)); err != nil {
+				return 0, err
+			}
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		switch kind {
+		case 0x00:
+			// Function type index
+			_, err = r.u32()
+		case 0x01:
+			// Table reference type and limits
+			if _, err = r.byte(); err == nil {
+				err = skipLimits(r)
+			}
+		case 0x02:
+			err = skipLimits(r)
+		case 0x03:
+			// Value type and mutability
+			globals++
+			err = r.skip(2)
+		default:
+			err = errors.New(fmt.Sprintf("unknown import kind %d", kind))
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return globals, nil
+}
+
+func skipLimits(r *reader) error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	n := 1
+	if flags&0x01 != 0 {
+		n = 2
+	}
+	return r.skipU32s(n)
+}
+
+// Append an entry to the vector of the section with the id, adding the section if needed.
+func appendEntry(sections []moduleSection, id byte, entry []byte) ([]moduleSection, error) {
+	for i, s := range sections {
+		if s.id != id {
+			continue
+		}
+		r := &reader{b: s.data}
+		n, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if id == sectionExport && exports(s.data, fuelExport) {
+			return nil, errors.New(fmt.Sprintf("module must not export '%s'", fuelExport))
+		}
+		data := append(encodeU32(n+1), s.data[r.pos:]...)
+		sections[i].data = append(data, entry...)
+		return sections, nil
+	}
+	// Insert before the first section that must follow it
+	s := moduleSection{id: id, data: append([]byte{0x01}, entry...)}
+	i := 0
+	for ; i < len(sections); i++ {
+		if o, ok := sectionOrder[sections[i].id]; ok && o > sectionOrder[id] {
+			break
+		}
+	}
+	return append(sections[:i], append([]moduleSection{s}, sections[i:]...)...), nil
+}
+
+// Reports whether an export section exports the name.
+func exports(data []byte, name string) bool {
+	r := &reader{b: data}
+	n, err := r.u32()
+	if err != nil {
+		return false
+	}
+	for i := uint32(0); i < n; i++ {
+		l, err := r.u32()
+		if err != nil {
+			return false
+		}
+		start := r.pos
+		if r.skip(int(l)) != nil {
+			return false
+		}
+		if string(r.b[start:r.pos]) == name {
+			return true
+		}
+		// Kind and index
+		if r.skip(1) != nil || r.skipU32s(1) != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// Code burning one unit of fuel from the global, trapping once none is left.
+func burn(global uint32) []byte {
+	g := encodeU32(global)
+	b := append([]byte{0x23}, g...)
+	// i64.const 1, i64.sub
+	b = append(b, 0x42, 0x01, 0x7d, 0x24)
+	b = append(b, g...)
+	b = append(b, 0x23)
+	b = append(b, g...)
+	// i64.const 0, i64.lt_s, if unreachable end
+	return append(b, 0x42, 0x00, 0x53, 0x04, 0x40, 0x00, 0x0b)
+}
+
+// Add fuel burning code to the start of every function and loop in a code section.
+func meterCode(data []byte, global uint32) ([]byte, error) {
+	r := &reader{b: data}
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	b := burn(global)
+	out := encodeU32(n)
+	for i := uint32(0); i < n; i++ {
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		start := r.pos
+		if err := r.skip(int(size)); err != nil {
+			return nil, err
+		}
+		body, err := meterBody(data[start:r.pos], b)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("function %d: %s", i, err.Error()))
+		}
+		out = append(out, encodeU32(uint32(len(body)))...)
+		out = append(out, body...)
+	}
+	return out, nil
+}
+
+func meterBody(body, burn []byte) ([]byte, error) {
+	r := &reader{b: body}
+	// Local declarations, a count and a type each
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < n; i++ {
+		if _, err := r.u32(); err != nil {
+			return nil, err
+		}
+		if err := r.skip(1); err != nil {
+			return nil, err
+		}
+	}
+	out := append([]byte{}, body[:r.pos]...)
+	out = append(out, burn...)
+	last := r.pos
+	for !r.done() {
+		op, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if err := skipImmediates(r, op); err != nil {
+			return nil, err
+		}
+		if op == 0x03 {
+			// Each iteration starts over at the beginning of the loop
+			out = append(out, body[last:r.pos]...)
+			out = append(out, burn...)
+			last = r.pos
+		}
+	}
+	return append(out, body[last:]...), nil
+}
+
+// Skip the immediates of an instruction.
+func skipImmediates(r *reader, op byte) error {
+	switch {
+	case op == 0x02 || op == 0x03 || op == 0x04:
+		return skipBlockType(r)
+	case op == 0x0c || op == 0x0d || op == 0x10 || op == 0xd2 ||
+		op >= 0x20 && op <= 0x26 || op == 0x3f || op == 0x40:
+		return r.skipU32s(1)
+	case op == 0x0e:
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		return r.skipU32s(int(n) + 1)
+	case op == 0x11 || op >= 0x28 && op <= 0x3e:
+		// Type and table, or memory alignment and offset
+		return r.skipU32s(2)
+	case op == 0x1c:
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		return r.skip(int(n))
+	case op == 0x41 || op == 0x42:
+		return r.skipSigned()
+	case op == 0x43:
+		return r.skip(4)
+	case op == 0x44:
+		return r.skip(8)
+	case op == 0xd0:
+		return r.skip(1)
+	case op == 0xfc:
+		return skipMisc(r)
+	case op == 0xfd:
+		return skipVector(r)
+	case op <= 0x01 || op == 0x05 || op == 0x0b || op == 0x0f || op == 0x1a || op == 0x1b ||
+		op >= 0x45 && op <= 0xc4 || op == 0xd1:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("unsupported instruction 0x%02x", op))
+}
+
+func skipBlockType(r *reader) error {
+	c, err := r.byte()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case 0x40, 0x7f, 0x7e, 0x7d, 0x7c, 0x7b, 0x70, 0x6f:
+		return nil
+	}
+	// A type index
+	r.pos--
+	return r.skipSigned()
+}
+
+// Skip the immediates of the 0xfc prefixed instructions.
+func skipMisc(r *reader) error {
+	op, err := r.u32()
+	if err != nil {
+		return err
+	}
+	switch {
+	case op <= 7:
+		return nil
+	case op == 8 || op == 10 || op == 12 || op == 14:
+		return r.skipU32s(2)
+	case op == 9 || op == 11 || op == 13 || op >= 15 && op <= 17:
+		return r.skipU32s(1)
+	}
+	return errors.New(fmt.Sprintf("unsupported instruction 0xfc %d", op))
+}
+
+// Skip the immediates of the 0xfd prefixed vector instructions.
+func skipVector(r *reader) error {
+	op, err := r.u32()
+	if err != nil {
+		return err
+	}
+	switch {
+	case op <= 11 || op == 92 || op == 93:
+		// Memory alignment and offset
+		return r.skipU32s(2)
+	case op == 12 || op == 13:
+		// Constant or shuffle lanes
+		return r.skip(16)
+	case op >= 21 && op <= 34:
+		// Lane index
+		return r.skip(1)
+	case op >= 84 && op <= 91:
+		if err := r.skipU32s(2); err != nil {
+			return err
+		}
+		return r.skip(1)
+	case op <= 255:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("unsupported instruction 0xfd %d", op))
+}
@@ -0,0 +1,404 @@
+// Package wasm runs pilots compiled to WebAssembly in a sandbox,
+// so pilots submitted by other teams can be flown without trusting their code.
+//
+// A ship uses a module from the data directory with:
+//
+//	pilot: wasm
+//	pilot_params:
+//	  module: pilots/mine.wasm
+//
+// The module must export a function tick(i64) which is called every tick
+// with the current tick. Optional exports init() and respawned() are called
+// before the first tick and after the ship respawns.
+// The host functions below are imported from the module "avi".
+// Functions taking a part index return ResultOK or a negative result code.
+//
+//	part_count(kind i32) i32
+//	engine_power(i i32, power f64) i32
+//	thruster_thrust(i i32, x f64, y f64, z f64) i32
+//	weapon_fire(i i32, x f64, y f64, z f64) i32
+//	scan(i i32, ptr i32, len i32) i32
+//	broadcast(i i32, ptr i32, len i32) i32
+//	log(ptr i32, len i32)
+//
+// scan writes the scan result as JSON to the buffer and returns its length.
+// If the buffer is too small nothing is written and the negated length is returned,
+// calling scan again the same tick returns the same result.
+//
+// Each module is limited to a fixed number of memory pages and an amount of
+// fuel per call into it. Modules are instrumented when loaded so every function
+// entry and loop iteration burns a unit of fuel, metering them deterministically.
+// A module that runs out of fuel or traps is closed and the ship is left without a pilot.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/golang/glog"
+	"github.com/nathanielc/avi"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Name the WebAssembly pilot is registered with.
+const PilotName = "wasm"
+
+func init() {
+	avi.RegisterPilot(PilotName, NewPilot)
+}
+
+// Part kinds for part_count.
+const (
+	KindEngine int32 = iota
+	KindThruster
+	KindWeapon
+	KindSensor
+	KindComms
+)
+
+// Results returned by host functions.
+const (
+	ResultOK int32 = 0
+	// The part index is out of range.
+	ResultNoPart int32 = -1
+	// The part refused the action, e.g. not enough energy.
+	ResultFailed int32 = -2
+	// A buffer lies outside the module's memory.
+	ResultBadMemory int32 = -3
+)
+
+// Limits applied to each module.
+type Limits struct {
+	// Maximum memory in 64KiB pages.
+	MemoryPages uint32
+	// Function entries and loop iterations allowed during each call into the module,
+	// including the call itself.
+	Fuel int64
+}
+
+var DefaultLimits = Limits{
+	MemoryPages: 16,
+	Fuel:        1e6,
+}
+
+var ErrOutOfFuel = errors.New("out of fuel")
+
+var (
+	mu       sync.Mutex
+	dataDir  = "data"
+	limits   = DefaultLimits
+	rt       wazero.Runtime
+	compiled = make(map[string]wazero.CompiledModule)
+)
+
+// Set the directory modules are loaded from.
+func SetDataDir(dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dataDir = dir
+}
+
+// Set the limits for modules, zero values use the defaults.
+// The memory limit is fixed per runtime, changing it closes all loaded modules.
+func SetLimits(l Limits) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l.MemoryPages == 0 {
+		l.MemoryPages = DefaultLimits.MemoryPages
+	}
+	if l.Fuel == 0 {
+		l.Fuel = DefaultLimits.Fuel
+	}
+	if l.MemoryPages != limits.MemoryPages {
+		closeRuntime()
+	}
+	limits = l
+}
+
+// Close the runtime and all modules loaded in it.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	closeRuntime()
+}
+
+func closeRuntime() {
+	if rt == nil {
+		return
+	}
+	if err := rt.Close(context.Background()); err != nil {
+		glog.Errorln("Failed to close wasm runtime", err)
+	}
+	rt = nil
+	compiled = make(map[string]wazero.CompiledModule)
+}
+
+// Load a module from the data directory, compiling it once per path.
+func load(ctx context.Context, path string) (wazero.Runtime, wazero.CompiledModule, error) {
+	if !strings.HasSuffix(path, ".wasm") {
+		return nil, nil, errors.New(fmt.Sprintf("module '%s' is not a .wasm file", path))
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, nil, errors.New(fmt.Sprintf("module '%s' is outside the data directory", path))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if rt == nil {
+		r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter().
+			WithMemoryLimitPages(limits.MemoryPages))
+		if _, err := hostModule(r).Instantiate(ctx); err != nil {
+			return nil, nil, err
+		}
+		rt = r
+	}
+	if cm, ok := compiled[clean]; ok {
+		return rt, cm, nil
+	}
+	code, err := ioutil.ReadFile(filepath.Join(dataDir, clean))
+	if err != nil {
+		return nil, nil, err
+	}
+	var cm wazero.CompiledModule
+	code, err = instrument(code)
+	if err == nil {
+		cm, err = rt.CompileModule(ctx, code)
+	}
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("invalid module '%s': %s", path, err.Error()))
+	}
+	if cm.ExportedFunctions()["tick"] == nil {
+		return nil, nil, errors.New(fmt.Sprintf("module '%s' does not export tick", path))
+	}
+	compiled[clean] = cm
+	return rt, cm, nil
+}
+
+type pilotParams struct {
+	// Path of the module relative to the data directory
+	Module string `yaml:"module"`
+}
+
+// Pilot flies a ship by calling into a WebAssembly module.
+type Pilot struct {
+	avi.GenericPilot
+
+	module  api.Module
+	limits  Limits
+	started bool
+	// Fuel left for the current call into the module
+	fuel api.MutableGlobal
+	// The scan already taken this tick by each sensor
+	scans map[int32][]byte
+}
+
+func NewPilot() avi.Pilot {
+	return &Pilot{}
+}
+
+func (p *Pilot) Configure(conf avi.ShipConf) error {
+	var params pilotParams
+	if err := avi.DecodePilotParams(conf.PilotParams, &params); err != nil {
+		return err
+	}
+	if params.Module == "" {
+		return errors.New("no module configured")
+	}
+	ctx := context.Background()
+	r, cm, err := load(ctx, params.Module)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	p.limits = limits
+	mu.Unlock()
+	// Modules are anonymous so each pilot gets its own instance
+	m, err := r.InstantiateModule(ctx, cm, wazero.NewModuleConfig().WithName("").WithStartFunctions())
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to instantiate module '%s': %s", params.Module, err.Error()))
+	}
+	p.module = m
+	p.fuel = m.ExportedGlobal(fuelExport).(api.MutableGlobal)
+	return nil
+}
+
+// Close the module, called once the ship is gone for good.
+func (p *Pilot) Close() {
+	if p.module != nil {
+		p.module.Close(context.Background())
+	}
+}
+
+func (p *Pilot) Tick(tick int64) {
+	if p.module == nil || p.module.IsClosed() {
+		return
+	}
+	p.scans = nil
+	if !p.started {
+		p.started = true
+		if !p.call("init") {
+			return
+		}
+	}
+	p.call("tick", uint64(tick))
+}
+
+func (p *Pilot) Respawned() {
+	if p.module != nil && !p.module.IsClosed() {
+		p.call("respawned")
+	}
+}
+
+// Call an exported function with a full tank of fuel, returns false if the module was closed.
+// Missing exports are ignored.
+func (p *Pilot) call(name string, params ...uint64) bool {
+	fn := p.module.ExportedFunction(name)
+	if fn == nil {
+		return true
+	}
+	p.fuel.Set(uint64(p.limits.Fuel))
+	if _, err := fn.Call(context.WithValue(context.Background(), pilotKey{}, p), params...); err != nil {
+		if int64(p.fuel.Get()) < 0 {
+			err = ErrOutOfFuel
+		}
+		glog.Errorf("Closing wasm pilot of fleet %s, %s failed: %v", p.Fleet, name, err)
+		p.module.Close(context.Background())
+		return false
+	}
+	return true
+}
+
+type pilotKey struct{}
+
+func hostModule(r wazero.Runtime) wazero.HostModuleBuilder {
+	return r.NewHostModuleBuilder("avi").
+		NewFunctionBuilder().WithFunc(partCount).Export("part_count").
+		NewFunctionBuilder().WithFunc(enginePower).Export("engine_power").
+		NewFunctionBuilder().WithFunc(thrusterThrust).Export("thruster_thrust").
+		NewFunctionBuilder().WithFunc(weaponFire).Export("weapon_fire").
+		NewFunctionBuilder().WithFunc(scan).Export("scan").
+		NewFunctionBuilder().WithFunc(broadcast).Export("broadcast").
+		NewFunctionBuilder().WithFunc(logMessage).Export("log")
+}
+
+func pilotFrom(ctx context.Context) *Pilot {
+	return ctx.Value(pilotKey{}).(*Pilot)
+}
+
+func result(err error) int32 {
+	if err != nil {
+		if glog.V(4) {
+			glog.Infoln("wasm pilot action failed", err)
+		}
+		return ResultFailed
+	}
+	return ResultOK
+}
+
+func partCount(ctx context.Context, kind int32) int32 {
+	p := pilotFrom(ctx)
+	switch kind {
+	case KindEngine:
+		return int32(len(p.Engines))
+	case KindThruster:
+		return int32(len(p.Thrusters))
+	case KindWeapon:
+		return int32(len(p.Weapons))
+	case KindSensor:
+		return int32(len(p.Sensors))
+	case KindComms:
+		return int32(len(p.Comms))
+	}
+	return 0
+}
+
+func enginePower(ctx context.Context, i int32, power float64) int32 {
+	p := pilotFrom(ctx)
+	if i < 0 || int(i) >= len(p.Engines) {
+		return ResultNoPart
+	}
+	return result(p.Engines[i].PowerOn(power))
+}
+
+func thrusterThrust(ctx context.Context, i int32, x, y, z float64) int32 {
+	p := pilotFrom(ctx)
+	if i < 0 || int(i) >= len(p.Thrusters) {
+		return ResultNoPart
+	}
+	return result(p.Thrusters[i].Thrust(mgl64.Vec3{x, y, z}))
+}
+
+func weaponFire(ctx context.Context, i int32, x, y, z float64) int32 {
+	p := pilotFrom(ctx)
+	if i < 0 || int(i) >= len(p.Weapons) {
+		return ResultNoPart
+	}
+	return result(p.Weapons[i].Fire(mgl64.Vec3{x, y, z}))
+}
+
+func scan(ctx context.Context, m api.Module, i, ptr, size int32) int32 {
+	p := pilotFrom(ctx)
+	if i < 0 || int(i) >= len(p.Sensors) {
+		return ResultNoPart
+	}
+	// Keep the scan so a retry with a larger buffer sees the same result
+	data, ok := p.scans[i]
+	if !ok {
+		sr, err := p.Sensors[i].Scan()
+		if err != nil {
+			return result(err)
+		}
+		data, err = json.Marshal(sr)
+		sr.Done()
+		if err != nil {
+			return result(err)
+		}
+		if p.scans == nil {
+			p.scans = make(map[int32][]byte)
+		}
+		p.scans[i] = data
+	}
+	if len(data) > int(size) {
+		return -int32(len(data))
+	}
+	mem := m.Memory()
+	if ptr < 0 || mem == nil || !mem.Write(uint32(ptr), data) {
+		return ResultBadMemory
+	}
+	return int32(len(data))
+}
+
+func broadcast(ctx context.Context, m api.Module, i, ptr, size int32) int32 {
+	p := pilotFrom(ctx)
+	if i < 0 || int(i) >= len(p.Comms) {
+		return ResultNoPart
+	}
+	mem := m.Memory()
+	if ptr < 0 || size < 0 || mem == nil {
+		return ResultBadMemory
+	}
+	data, ok := mem.Read(uint32(ptr), uint32(size))
+	if !ok {
+		return ResultBadMemory
+	}
+	return result(p.Comms[i].Broadcast(data))
+}
+
+func logMessage(ctx context.Context, m api.Module, ptr, size int32) {
+	mem := m.Memory()
+	if ptr < 0 || size < 0 || mem == nil {
+		return
+	}
+	if msg, ok := mem.Read(uint32(ptr), uint32(size)); ok {
+		glog.Infof("wasm pilot of fleet %s: %s", pilotFrom(ctx).Fleet, msg)
+	}
+}
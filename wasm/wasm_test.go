@@ -0,0 +1,483 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/nathanielc/avi"
+	"github.com/nathanielc/avi/avitest"
+)
+
+// Helpers to hand encode small modules in the binary format.
+
+func uleb(n uint32) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func sleb(n int32) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 && c&0x40 == 0 || n == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func name(s string) []byte {
+	return append(uleb(uint32(len(s))), s...)
+}
+
+func vec(items ...[]byte) []byte {
+	b := uleb(uint32(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func cat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func section(id byte, content []byte) []byte {
+	return cat([]byte{id}, uleb(uint32(len(content))), content)
+}
+
+func f64(v float64) []byte {
+	b := make([]byte, 9)
+	b[0] = 0x44
+	binary.LittleEndian.PutUint64(b[1:], math.Float64bits(v))
+	return b
+}
+
+const (
+	i32 = 0x7f
+	i64 = 0x7e
+	fp  = 0x7c
+)
+
+func funcType(params, results []byte) []byte {
+	return cat([]byte{0x60}, vec(split(params)...), vec(split(results)...))
+}
+
+func split(b []byte) [][]byte {
+	items := make([][]byte, len(b))
+	for i := range b {
+		items[i] = b[i : i+1]
+	}
+	return items
+}
+
+// A function body without locals.
+func body(code ...byte) []byte {
+	b := cat([]byte{0x00}, code, []byte{0x0b})
+	return append(uleb(uint32(len(b))), b...)
+}
+
+// A function body with locals, each local is a count and a type.
+func bodyLocals(locals [][]byte, code ...byte) []byte {
+	b := cat(vec(locals...), code, []byte{0x0b})
+	return append(uleb(uint32(len(b))), b...)
+}
+
+var header = []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+// Module exporting tick with the given body and optionally a memory of min pages.
+func tickModule(pages uint32, code ...byte) []byte {
+	m := cat(header,
+		section(1, vec(funcType([]byte{i64}, nil))),
+		section(3, vec(uleb(0))),
+	)
+	if pages > 0 {
+		m = append(m, section(5, vec(cat([]byte{0x00}, uleb(pages))))...)
+	}
+	return cat(m,
+		section(7, vec(cat(name("tick"), []byte{0x00, 0x00}))),
+		section(10, vec(body(code...))),
+	)
+}
+
+// Module that records the results of host calls in exported globals.
+func probeModule() []byte {
+	global := []byte{i32, 0x01, 0x41, 0x00, 0x0b}
+	code := cat(
+		// engines = part_count(KindEngine)
+		[]byte{0x41, 0x00, 0x10, 0x00, 0x24, 0x00},
+		// ok = engine_power(0, 0.5)
+		[]byte{0x41, 0x00}, f64(0.5), []byte{0x10, 0x01, 0x24, 0x01},
+		// bad = engine_power(0, 2)
+		[]byte{0x41, 0x00}, f64(2), []byte{0x10, 0x01, 0x24, 0x02},
+		// missing = engine_power(5, 1)
+		[]byte{0x41, 0x05}, f64(1), []byte{0x10, 0x01, 0x24, 0x03},
+	)
+	return cat(header,
+		section(1, vec(
+			funcType([]byte{i32}, []byte{i32}),
+			funcType([]byte{i32, fp}, []byte{i32}),
+			funcType([]byte{i64}, nil),
+		)),
+		section(2, vec(
+			cat(name("avi"), name("part_count"), []byte{0x00, 0x00}),
+			cat(name("avi"), name("engine_power"), []byte{0x00, 0x01}),
+		)),
+		section(3, vec(uleb(2))),
+		section(6, vec(global, global, global, global)),
+		section(7, vec(
+			cat(name("tick"), []byte{0x00, 0x02}),
+			cat(name("engines"), []byte{0x03, 0x00}),
+			cat(name("ok"), []byte{0x03, 0x01}),
+			cat(name("bad"), []byte{0x03, 0x02}),
+			cat(name("missing"), []byte{0x03, 0x03}),
+		)),
+		section(10, vec(body(code...))),
+	)
+}
+
+// Module whose tick calls an empty function n times.
+func callsModule(n int32) []byte {
+	code := cat(
+		// loop
+		[]byte{0x03, 0x40},
+		// call f
+		[]byte{0x10, 0x01},
+		// local.tee 1 (local.get 1 + 1)
+		[]byte{0x20, 0x01, 0x41, 0x01, 0x6a, 0x22, 0x01},
+		// br_if 0 (i < n)
+		[]byte{0x41}, sleb(n), []byte{0x48, 0x0d, 0x00},
+		// end
+		[]byte{0x0b},
+	)
+	return cat(header,
+		section(1, vec(funcType([]byte{i64}, nil), funcType(nil, nil))),
+		section(3, vec(uleb(0), uleb(1))),
+		section(7, vec(cat(name("tick"), []byte{0x00, 0x00}))),
+		section(10, vec(bodyLocals([][]byte{{0x01, i32}}, code...), body())),
+	)
+}
+
+// Module that exercises the part actions, scan and broadcast every tick,
+// recording the results in exported globals.
+func actionsModule() []byte {
+	global := []byte{i32, 0x01, 0x41, 0x00, 0x0b}
+	globals := []string{"thrust", "fire", "fire_missing", "broadcast", "broadcast_bad", "scan_small", "scan_full", "scan_missing", "fired"}
+	call := func(fn byte, g int, args ...[]byte) []byte {
+		return cat(cat(args...), []byte{0x10, fn, 0x24, byte(g)})
+	}
+	i32c := func(v int32) []byte { return cat([]byte{0x41}, sleb(v)) }
+	code := cat(
+		// engine_power(0, 1)
+		i32c(0), f64(1), []byte{0x10, 0x00, 0x1a},
+		call(1, 0, i32c(0), f64(1), f64(0), f64(0)),
+		call(2, 1, i32c(0), f64(1), f64(0), f64(0)),
+		// fired |= fire == ResultOK
+		[]byte{0x23, 0x01, 0x45, 0x23, 0x08, 0x72, 0x24, 0x08},
+		call(2, 2, i32c(9), f64(1), f64(0), f64(0)),
+		// broadcast "hello" from the data segment
+		call(4, 3, i32c(0), i32c(0), i32c(5)),
+		call(4, 4, i32c(0), i32c(65536), i32c(5)),
+		// scan into a buffer that is too small, then one that is large enough
+		call(3, 5, i32c(0), i32c(16), i32c(4)),
+		call(3, 6, i32c(0), i32c(16), i32c(60000)),
+		call(3, 7, i32c(4), i32c(16), i32c(60000)),
+	)
+	exports := [][]byte{
+		cat(name("tick"), []byte{0x00, 0x05}),
+		cat(name("memory"), []byte{0x02, 0x00}),
+	}
+	var gs [][]byte
+	for i, g := range globals {
+		gs = append(gs, global)
+		exports = append(exports, cat(name(g), []byte{0x03, byte(i)}))
+	}
+	return cat(header,
+		section(1, vec(
+			funcType([]byte{i32, fp}, []byte{i32}),
+			funcType([]byte{i32, fp, fp, fp}, []byte{i32}),
+			funcType([]byte{i32, i32, i32}, []byte{i32}),
+			funcType([]byte{i64}, nil),
+		)),
+		section(2, vec(
+			cat(name("avi"), name("engine_power"), []byte{0x00, 0x00}),
+			cat(name("avi"), name("thruster_thrust"), []byte{0x00, 0x01}),
+			cat(name("avi"), name("weapon_fire"), []byte{0x00, 0x01}),
+			cat(name("avi"), name("scan"), []byte{0x00, 0x02}),
+			cat(name("avi"), name("broadcast"), []byte{0x00, 0x02}),
+		)),
+		section(3, vec(uleb(3))),
+		section(5, vec([]byte{0x00, 0x01})),
+		section(6, vec(gs...)),
+		section(7, vec(exports...)),
+		section(10, vec(body(code...))),
+		section(11, vec(cat([]byte{0x00, 0x41, 0x00, 0x0b}, name("hello")))),
+	)
+}
+
+func setup(t *testing.T, modules map[string][]byte) func() {
+	dir, err := ioutil.TempDir("", "avi-wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, code := range modules {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), code, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetDataDir(dir)
+	SetLimits(DefaultLimits)
+	return func() {
+		os.RemoveAll(dir)
+		SetDataDir("data")
+		SetLimits(DefaultLimits)
+	}
+}
+
+func newPilot(t *testing.T, module string) *Pilot {
+	p := NewPilot().(*Pilot)
+	p.JoinFleet("f1")
+	if err := p.Configure(avi.ShipConf{PilotParams: map[string]interface{}{"module": module}}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func global(p *Pilot, name string) int32 {
+	return int32(uint32(p.module.ExportedGlobal(name).Get()))
+}
+
+func TestHostAPI(t *testing.T) {
+	defer setup(t, map[string][]byte{"probe.wasm": probeModule()})()
+
+	p := newPilot(t, "probe.wasm")
+	p.Engines = []*avi.Engine{avi.NewEngine001(mgl64.Vec3{})}
+	p.Tick(0)
+	if p.module.IsClosed() {
+		t.Fatal("module closed")
+	}
+	for name, exp := range map[string]int32{
+		"engines": 1,
+		"ok":      ResultOK,
+		"bad":     ResultFailed,
+		"missing": ResultNoPart,
+	} {
+		if got := global(p, name); got != exp {
+			t.Errorf("unexpected %s got %d exp %d", name, got, exp)
+		}
+	}
+
+	// Each pilot has its own instance
+	other := newPilot(t, "probe.wasm")
+	if got := global(other, "engines"); got != 0 {
+		t.Errorf("instance state shared, got %d engines", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	defer setup(t, map[string][]byte{
+		// loop br 0 end
+		"spin.wasm":  tickModule(0, 0x03, 0x40, 0x0c, 0x00, 0x0b),
+		"calls.wasm": callsModule(99),
+		"over.wasm":  callsModule(100),
+		"big.wasm":   tickModule(32),
+		// memory.grow(100) must fail, trap if it succeeds
+		"grow.wasm": tickModule(1,
+			0x41, 0xe4, 0x00, 0x40, 0x00,
+			0x41, 0x7f, 0x47, 0x04, 0x40, 0x00, 0x0b),
+	})()
+	SetLimits(Limits{Fuel: 200})
+
+	// The tick, its 99 loop iterations and 99 calls fit the fuel every tick
+	p := newPilot(t, "calls.wasm")
+	for tick := int64(0); tick < 3; tick++ {
+		p.Tick(tick)
+	}
+	if p.module.IsClosed() {
+		t.Error("module within its fuel was closed")
+	}
+	p = newPilot(t, "over.wasm")
+	p.Tick(0)
+	if !p.module.IsClosed() {
+		t.Error("expected module to be closed after running out of fuel")
+	}
+
+	// Loops without calls burn fuel every iteration
+	p = newPilot(t, "spin.wasm")
+	p.Tick(0)
+	if !p.module.IsClosed() {
+		t.Error("expected module to be closed after running out of fuel")
+	}
+	if got := int64(p.fuel.Get()); got != -1 {
+		t.Errorf("unexpected fuel left got %d exp -1", got)
+	}
+	// Closed pilots are inert
+	p.Tick(1)
+
+	p = newPilot(t, "grow.wasm")
+	p.Tick(0)
+	if p.module.IsClosed() {
+		t.Error("memory grew beyond the limit")
+	}
+
+	err := NewPilot().(*Pilot).Configure(avi.ShipConf{PilotParams: map[string]interface{}{"module": "big.wasm"}})
+	if err == nil {
+		t.Error("expected error for module exceeding the memory limit")
+	}
+}
+
+func TestSetLimitsClosesRuntime(t *testing.T) {
+	defer setup(t, map[string][]byte{"calls.wasm": callsModule(1)})()
+
+	p := newPilot(t, "calls.wasm")
+	SetLimits(Limits{MemoryPages: 8})
+	if !p.module.IsClosed() {
+		t.Error("expected modules to be closed with their runtime")
+	}
+	p = newPilot(t, "calls.wasm")
+	p.Tick(0)
+	if p.module.IsClosed() {
+		t.Error("module in the new runtime was closed")
+	}
+	p.Close()
+	if !p.module.IsClosed() {
+		t.Error("expected closed module")
+	}
+}
+
+const actionsFleet = `
+name: wasm
+ships:
+  - pilot: wasm
+    pilot_params: {module: actions.wasm}
+    position: [0, 0, 0]
+    hull_strength: 1
+    parts: &PARTS
+      - {name: nuclear, type: engine, position: [0, 0, 0]}
+      - {name: rocket, type: thruster, position: [20, 0, 0]}
+      - {name: rifle, type: weapon, position: [0, 15, 0]}
+      - {name: antenna, type: sensor, position: [0, 0, -12]}
+      - {name: radio, type: comms, position: [0, 0, 12]}
+  - pilot: wasm
+    pilot_params: {module: actions.wasm}
+    position: [0, 100, 0]
+    hull_strength: 1
+    parts: *PARTS
+`
+
+func TestActions(t *testing.T) {
+	defer setup(t, map[string][]byte{"actions.wasm": actionsModule()})()
+
+	// Failed shots spend ammunition, so cool down quickly enough to fire before running out
+	parts := strings.Replace(avitest.DefaultParts, "cooldown: 1\n", "cooldown: 0.1\n", 1)
+	s := avitest.NewWithParts(t, parts, ``, actionsFleet)
+	ships := s.Fleet("wasm")
+	p := ships[0].Pilot.(*Pilot)
+	s.Step(3)
+	if p.module.IsClosed() {
+		t.Fatal("module closed")
+	}
+	for name, exp := range map[string]int32{
+		"thrust": ResultOK,
+		// Weapons are cooling down
+		"fire":          ResultFailed,
+		"fire_missing":  ResultNoPart,
+		"broadcast":     ResultOK,
+		"broadcast_bad": ResultBadMemory,
+		"scan_missing":  ResultNoPart,
+	} {
+		if got := global(p, name); got != exp {
+			t.Errorf("unexpected %s got %d exp %d", name, got, exp)
+		}
+	}
+
+	// The retry with a large enough buffer gets the same scan
+	size := global(p, "scan_full")
+	if small := global(p, "scan_small"); size <= 0 || small != -size {
+		t.Fatalf("unexpected scan sizes %d and %d", small, size)
+	}
+	data, ok := p.module.Memory().Read(16, uint32(size))
+	if !ok {
+		t.Fatal("scan outside memory")
+	}
+	var sr avi.ScanResult
+	if err := json.Unmarshal(data, &sr); err != nil {
+		t.Fatal(err)
+	}
+	if sr.ID != ships[0].ID {
+		t.Errorf("unexpected scan of %d", sr.ID)
+	}
+	if _, ok := sr.Ships[ships[1].ID]; !ok {
+		t.Errorf("fleet mate missing from scan %v", sr.Ships)
+	}
+	if len(sr.Messages) != 1 || sr.Messages[0].From != ships[1].ID || string(sr.Messages[0].Data) != "hello" {
+		t.Errorf("unexpected messages %v", sr.Messages)
+	}
+
+	if global(p, "fired") != 0 {
+		t.Error("fired while cooling down")
+	}
+
+	// Thrusting along x while the weapon cools down, then firing
+	s.Run(time.Second)
+	if global(p, "fired") != 1 {
+		t.Error("expected weapon to fire after cooling down")
+	}
+	if ship, _ := s.Ship(ships[0].ID); ship.Velocity.X() <= 0 {
+		t.Errorf("unexpected velocity %v", ship.Velocity)
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	defer setup(t, map[string][]byte{
+		"notick.wasm":  cat(header),
+		"garbage.wasm": []byte("not wasm"),
+		"fuel.wasm": cat(header,
+			section(1, vec(funcType([]byte{i64}, nil))),
+			section(3, vec(uleb(0))),
+			section(7, vec(cat(name("tick"), []byte{0x00, 0x00}), cat(name(fuelExport), []byte{0x00, 0x00}))),
+			section(10, vec(body())),
+		),
+	})()
+
+	testCases := []struct {
+		params map[string]interface{}
+		err    string
+	}{
+		{params: nil, err: "no module"},
+		{params: map[string]interface{}{"module": "pilot.so"}, err: "not a .wasm file"},
+		{params: map[string]interface{}{"module": "../pilot.wasm"}, err: "outside the data directory"},
+		{params: map[string]interface{}{"module": "/tmp/pilot.wasm"}, err: "outside the data directory"},
+		{params: map[string]interface{}{"module": "missing.wasm"}, err: "no such file"},
+		{params: map[string]interface{}{"module": "garbage.wasm"}, err: "invalid module"},
+		{params: map[string]interface{}{"module": "notick.wasm"}, err: "does not export tick"},
+		{params: map[string]interface{}{"module": "fuel.wasm"}, err: "must not export"},
+		{params: map[string]interface{}{"module": "notick.wasm", "fuel": 10}, err: "fuel"},
+	}
+	for _, tc := range testCases {
+		err := NewPilot().(*Pilot).Configure(avi.ShipConf{PilotParams: tc.params})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v: expected error containing %q got %v", tc.params, tc.err, err)
+		}
+	}
+}
@@ -17,8 +17,15 @@ type Weapon struct {
 	ammoMass      float64
 	ammoRadius    float64
 	ammoCapacity  int64
+	maxAmmo       int64
+	resupplied    float64
 	cooldownTicks int64
 	lastshot      int64
+	pointDefence  bool
+	defenceRadius float64
+	maxRange      float64
+	lifetimeTicks int64
+	drag          float64
 }
 
 // Conf format for loading weapons from a file
@@ -31,6 +38,26 @@ type WeaponConf struct {
 	AmmoCapacity int64   `yaml:"ammo_capacity" json:"ammo_capacity"`
 	AmmoRadius   float64 `yaml:"ammo_radius" json:"ammo_radius"`
 	Cooldown     float64 `yaml:"cooldown" json:"cooldown"`
+	// Distance in meters projectiles travel before they are removed, zero means unlimited.
+	Range float64 `yaml:"range" json:"range"`
+	// Time in seconds projectiles live before they are removed, zero means unlimited.
+	Lifetime float64 `yaml:"lifetime" json:"lifetime"`
+	// Exponential rate per second at which projectiles lose velocity.
+	Drag float64 `yaml:"drag" json:"drag"`
+	// Point defence weapons automatically fire at incoming
+	// enemy projectiles within the defence radius.
+	PointDefence  bool    `yaml:"point_defence" json:"point_defence"`
+	DefenceRadius float64 `yaml:"defence_radius" json:"defence_radius"`
+}
+
+func (c WeaponConf) Validate() error {
+	if c.Range < 0 || c.Lifetime < 0 || c.Drag < 0 {
+		return errors.New("weapon range, lifetime and drag must not be negative")
+	}
+	if c.PointDefence && c.DefenceRadius <= 0 {
+		return errors.New(fmt.Sprintf("point defence weapons need a positive defence_radius: %f", c.DefenceRadius))
+	}
+	return nil
 }
 
 func NewWeapon001(pos mgl64.Vec3) *Weapon {
@@ -47,6 +74,7 @@ func NewWeapon001(pos mgl64.Vec3) *Weapon {
 		ammoMass:      1,
 		ammoRadius:    0.05,
 		ammoCapacity:  1e5,
+		maxAmmo:       1e5,
 		cooldownTicks: int64(5.0 / SecondsPerTick),
 	}
 }
@@ -65,7 +93,13 @@ func NewWeaponFromConf(pos mgl64.Vec3, conf WeaponConf) *Weapon {
 		ammoMass:      conf.AmmoMass,
 		ammoRadius:    conf.AmmoRadius,
 		ammoCapacity:  conf.AmmoCapacity,
+		maxAmmo:       conf.AmmoCapacity,
 		cooldownTicks: int64(conf.Cooldown / SecondsPerTick),
+		pointDefence:  conf.PointDefence,
+		defenceRadius: conf.DefenceRadius,
+		maxRange:      conf.Range,
+		lifetimeTicks: int64(conf.Lifetime / SecondsPerTick),
+		drag:          conf.Drag,
 	}
 }
 
@@ -102,11 +136,103 @@ func (self *Weapon) Fire(dir mgl64.Vec3) error {
 	pos := norm.Mul(self.ship.radius + 1).Add(self.ship.position)
 	vel := norm.Mul(self.ammoVelocity).Add(self.ship.velocity)
 
-	self.ship.sim.addProjectile(pos, vel, self.ammoMass, self.ammoRadius)
+	p := newProjectile(pos, vel, self.ammoMass, self.ammoRadius)
+	p.team = self.ship.team
+	p.shooter = self.ship
+	p.maxRange = self.maxRange
+	p.setDrag(self.drag)
+	lifetime := self.lifetimeTicks
+	if self.pointDefence && self.ammoVelocity > 0 {
+		// Point defence rounds only live long enough to cross the defence radius twice
+		pd := int64(2*self.defenceRadius/self.ammoVelocity/SecondsPerTick) + 1
+		if lifetime == 0 || pd < lifetime {
+			lifetime = pd
+		}
+	}
+	if lifetime > 0 {
+		p.expires = self.ship.sim.tick + lifetime
+	}
+	self.ship.sim.addProjectile(p)
 
 	return nil
 }
 
+// Automatically fire a point defence weapon at the most urgent incoming threat.
+func (self *Weapon) defend() {
+	if !self.pointDefence || self.ammoCapacity <= 0 {
+		return
+	}
+	if self.lastshot+self.cooldownTicks > self.ship.sim.tick {
+		return
+	}
+	ship := self.ship
+	r2 := self.defenceRadius * self.defenceRadius
+	var threat *projectile
+	threatT := math.Inf(1)
+	ship.sim.projGrid.near(ship.position, self.defenceRadius, func(p *projectile) {
+		if p.team == ship.team {
+			return
+		}
+		deltaPos := p.position.Sub(ship.position)
+		if LengthSq(deltaPos) > r2 {
+			return
+		}
+		deltaVel := p.velocity.Sub(ship.velocity)
+		closing := -deltaVel.Dot(deltaPos)
+		// Not incoming
+		if closing <= 0 {
+			return
+		}
+		// Time to closest approach
+		t := closing / LengthSq(deltaVel)
+		if t < threatT {
+			threatT = t
+			threat = p
+		}
+	})
+	if threat == nil {
+		return
+	}
+	deltaPos := threat.position.Sub(ship.position)
+	deltaVel := threat.velocity.Sub(ship.velocity)
+	t := InterceptTime(deltaPos, deltaVel, self.ammoVelocity)
+	if t <= 0 {
+		return
+	}
+	self.Fire(deltaPos.Mul(1 / t).Add(deltaVel))
+}
+
+// InterceptTime is the time for a projectile fired with speed va to reach a target at deltaPos
+// moving with deltaVel, relative to the shooter. Returns -1 if no intercept exists.
+func InterceptTime(deltaPos, deltaVel mgl64.Vec3, va float64) float64 {
+	a := LengthSq(deltaVel) - va*va
+	b := 2 * deltaPos.Dot(deltaVel)
+	c := LengthSq(deltaPos)
+	if math.Abs(a) < small {
+		if b >= 0 {
+			return -1
+		}
+		return -c / b
+	}
+	det := b*b - 4*a*c
+	if det < 0 {
+		return -1
+	}
+	sqrtDet := math.Sqrt(det)
+	t1 := (-b - sqrtDet) / (2 * a)
+	t2 := (-b + sqrtDet) / (2 * a)
+	if t1 > t2 {
+		t1, t2 = t2, t1
+	}
+	if t1 > 0 {
+		return t1
+	}
+	if t2 > 0 {
+		return t2
+	}
+	return -1
+}
+
 func (self *Weapon) GetCoolDownTicks() int64 {
 	return self.cooldownTicks
 }
@@ -114,3 +240,39 @@ func (self *Weapon) GetCoolDownTicks() int64 {
 func (self *Weapon) GetAmmoVel() float64 {
 	return self.ammoVelocity
 }
+
+// Rounds of ammunition remaining.
+func (self *Weapon) GetAmmo() int64 {
+	return self.ammoCapacity
+}
+
+// Rounds of ammunition the weapon holds when fully supplied.
+func (self *Weapon) GetAmmoCapacity() int64 {
+	return self.maxAmmo
+}
+
+// Restore rounds of ammunition, fractions of a round accumulate until a whole round is restored.
+func (self *Weapon) resupply(rounds float64) {
+	if self.ammoCapacity >= self.maxAmmo {
+		self.resupplied = 0
+		return
+	}
+	self.resupplied += rounds
+	n := int64(self.resupplied)
+	if n > self.maxAmmo-self.ammoCapacity {
+		n = self.maxAmmo - self.ammoCapacity
+	}
+	self.resupplied -= float64(n)
+	self.ammoCapacity += n
+	self.ship.mass += float64(n) * self.ammoMass
+}
+
+// Maximum distance projectiles travel, zero means unlimited.
+func (self *Weapon) GetRange() float64 {
+	return self.maxRange
+}
+
+// Maximum time in seconds projectiles live, zero means unlimited.
+func (self *Weapon) GetLifetime() float64 {
+	return float64(self.lifetimeTicks) * SecondsPerTick
+}
@@ -0,0 +1,222 @@
+package avi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+const (
+	ZoneSphere = "sphere"
+	ZoneBox    = "box"
+)
+
+const zoneTexture = "zone"
+
+// Conf format for regions of the map with environmental effects.
+type ZoneConf struct {
+	// Either 'sphere' or 'box', defaults to 'sphere'.
+	Shape    string    `yaml:"shape" json:"shape"`
+	Position []float64 `yaml:"position" json:"position"`
+	// Radius of a sphere zone.
+	Radius float64 `yaml:"radius" json:"radius"`
+	// Dimensions of a box zone.
+	Size []float64 `yaml:"size" json:"size"`
+	// Exponential rate per second at which objects inside the zone lose velocity.
+	Drag float64 `yaml:"drag" json:"drag"`
+	// Fraction between 0 and 1 by which sensor intensity is reduced for ships inside the zone.
+	SensorDampening float64 `yaml:"sensor_dampening" json:"sensor_dampening"`
+	// Hull damage per second dealt to ships inside the zone.
+	Damage float64 `yaml:"damage" json:"damage"`
+	// Fraction between 0 and 1 of engine output lost by ships inside the zone.
+	EnergyDrain float64 `yaml:"energy_drain" json:"energy_drain"`
+	// Hull repaired per second for ships inside the zone, up to their original strength.
+	Repair float64 `yaml:"repair" json:"repair"`
+	// Rounds of ammunition per second restored to each weapon of ships inside the zone.
+	Resupply float64 `yaml:"resupply" json:"resupply"`
+	Texture  string  `yaml:"texture" json:"texture"`
+}
+
+type zone struct {
+	id         ID
+	shape      string
+	position   mgl64.Vec3
+	radius     float64
+	halfSize   mgl64.Vec3
+	dragFactor float64
+	conf       ZoneConf
+	texture    string
+}
+
+// Scan result of a zone
+type ZoneSR struct {
+	ID              ID
+	Shape           string
+	Position        mgl64.Vec3
+	Radius          float64
+	Size            mgl64.Vec3
+	Drag            float64
+	SensorDampening float64
+	Damage          float64
+	EnergyDrain     float64
+	Repair          float64
+	Resupply        float64
+}
+
+func NewZone(id ID, conf ZoneConf) (*zone, error) {
+	pos, err := sliceToVec(conf.Position)
+	if err != nil {
+		return nil, err
+	}
+	if conf.SensorDampening < 0 || conf.SensorDampening > 1 {
+		return nil, errors.New(fmt.Sprintf("zone sensor_dampening must be between 0 and 1: %f", conf.SensorDampening))
+	}
+	if conf.EnergyDrain < 0 || conf.EnergyDrain > 1 {
+		return nil, errors.New(fmt.Sprintf("zone energy_drain must be between 0 and 1: %f", conf.EnergyDrain))
+	}
+	if conf.Drag < 0 || conf.Damage < 0 || conf.Repair < 0 || conf.Resupply < 0 {
+		return nil, errors.New("zone drag, damage, repair and resupply must not be negative")
+	}
+	texture := conf.Texture
+	if texture == "" {
+		texture = zoneTexture
+	}
+	z := &zone{
+		id:         id,
+		shape:      conf.Shape,
+		position:   pos,
+		dragFactor: math.Exp(-conf.Drag * SecondsPerTick),
+		conf:       conf,
+		texture:    texture,
+	}
+	switch conf.Shape {
+	case "", ZoneSphere:
+		z.shape = ZoneSphere
+		z.radius = conf.Radius
+	case ZoneBox:
+		size, err := sliceToVec(conf.Size)
+		if err != nil {
+			return nil, err
+		}
+		z.halfSize = size.Mul(0.5)
+		z.radius = z.halfSize.Len()
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown zone shape '%s'", conf.Shape))
+	}
+	if z.radius <= 0 {
+		return nil, errors.New("zone must have a positive size")
+	}
+	return z, nil
+}
+
+func (z *zone) ID() ID {
+	return z.id
+}
+
+func (z *zone) Position() mgl64.Vec3 {
+	return z.position
+}
+
+// Radius of the zone, for boxes this is the radius of the bounding sphere.
+func (z *zone) Radius() float64 {
+	return z.radius
+}
+
+// Dimensions of the zone.
+func (z *zone) Size() mgl64.Vec3 {
+	if z.shape == ZoneBox {
+		return z.halfSize.Mul(2)
+	}
+	d := 2 * z.radius
+	return mgl64.Vec3{d, d, d}
+}
+
+func (z *zone) Texture() string {
+	return z.texture
+}
+
+func (z *zone) contains(pos mgl64.Vec3) bool {
+	delta := pos.Sub(z.position)
+	if z.shape == ZoneBox {
+		return math.Abs(delta.X()) <= z.halfSize.X() &&
+			math.Abs(delta.Y()) <= z.halfSize.Y() &&
+			math.Abs(delta.Z()) <= z.halfSize.Z()
+	}
+	return LengthSq(delta) <= z.radius*z.radius
+}
+
+func (z *zone) scan() ZoneSR {
+	return ZoneSR{
+		ID:              z.id,
+		Shape:           z.shape,
+		Position:        z.position,
+		Radius:          z.radius,
+		Size:            z.Size(),
+		Drag:            z.conf.Drag,
+		SensorDampening: z.conf.SensorDampening,
+		Damage:          z.conf.Damage,
+		EnergyDrain:     z.conf.EnergyDrain,
+		Repair:          z.conf.Repair,
+		Resupply:        z.conf.Resupply,
+	}
+}
+
+// Fraction of sensor intensity dampened by the zones containing the position.
+func (sim *Simulation) dampeningAt(pos mgl64.Vec3) float64 {
+	intensity := 1.0
+	for _, z := range sim.zones {
+		if z.conf.SensorDampening > 0 && z.contains(pos) {
+			intensity *= 1 - z.conf.SensorDampening
+		}
+	}
+	return 1 - intensity
+}
+
+// Apply the effects of all zones to the ships and projectiles inside them.
+func (sim *Simulation) applyZones() {
+	for _, ship := range sim.ships {
+		ship.energyDrain = 0
+		ship.dampening = 0
+		if len(sim.zones) == 0 {
+			continue
+		}
+		// Fraction of energy and sensor intensity that remains
+		energy := 1.0
+		intensity := 1.0
+		for _, z := range sim.zones {
+			if !z.contains(ship.position) {
+				continue
+			}
+			energy *= 1 - z.conf.EnergyDrain
+			intensity *= 1 - z.conf.SensorDampening
+			if z.conf.Damage > 0 {
+				ship.setHealth(ship.Health() - z.conf.Damage*SecondsPerTick)
+			}
+			if z.conf.Drag > 0 {
+				ship.setVelocity(ship.Velocity().Mul(z.dragFactor))
+			}
+			if z.conf.Repair > 0 {
+				ship.setHealth(math.Min(ship.Health()+z.conf.Repair*SecondsPerTick, ship.maxHealth))
+			}
+			if z.conf.Resupply > 0 {
+				for _, w := range ship.weapons {
+					w.resupply(z.conf.Resupply * SecondsPerTick)
+				}
+			}
+		}
+		ship.energyDrain = 1 - energy
+		ship.dampening = 1 - intensity
+	}
+	for _, z := range sim.zones {
+		if z.conf.Drag == 0 {
+			continue
+		}
+		for _, p := range sim.projs {
+			if z.contains(p.position) {
+				p.setVelocity(p.Velocity().Mul(z.dragFactor))
+			}
+		}
+	}
+}